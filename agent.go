@@ -3,33 +3,174 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"io"
+	"net"
 	"net/http"
-	"os"
+	"sync"
+	"time"
 )
 
 import . "hive-arena/common"
 
-func request(url string) string {
+// HTTPError is returned when the server answers with a non-200 status.
+// 4xx answers are our fault (bad token, unknown game) and are not retried.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// NetworkError wraps a failure to reach the server at all (refused, reset, timeout).
+type NetworkError struct {
+	Op  string
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// ProtocolError is returned when the server sent something we could not decode.
+type ProtocolError struct {
+	URL string
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("bad response from %s: %v", e.URL, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error { return e.Err }
+
+// ErrRetriesExhausted is wrapped around the last error once a RetryPolicy gives up.
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryPolicy is an exponential backoff: BaseDelay, 2*BaseDelay, ... capped at MaxDelay.
+// Reconnects caps how often in a row the websocket is re-dialled without a turn
+// played in between, for a server that accepts the socket and drops it every time.
+// Timeout bounds each request, so a hung server is retried instead of waited on.
+type RetryPolicy struct {
+	Attempts   int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Reconnects int
+	Timeout    time.Duration
+}
+
+// DefaultRetry is the policy for playing on the real arena
+func DefaultRetry() RetryPolicy {
+	return RetryPolicy{
+		Attempts:   8,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   3 * time.Second,
+		Reconnects: 5,
+		Timeout:    5 * time.Second,
+	}
+}
 
-	resp, err := http.Get(url)
+func (p RetryPolicy) client() *http.Client {
+	return &http.Client{Timeout: p.Timeout}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// isTemporary decides whether an error is worth retrying.
+func isTemporary(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	var netErr *NetworkError
+	var protoErr *ProtocolError
+	return errors.As(err, &netErr) || errors.As(err, &protoErr) // a truncated body decodes badly too
+}
+
+// notSent is true for an error from before the request reached the server,
+// for requests that must not be made twice
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retry runs fn until it succeeds, fails permanently, or the policy runs out of attempts.
+func (p RetryPolicy) retry(op string, fn func() error) error {
+	return p.retryWhile(op, isTemporary, fn)
+}
+
+// retryWhile is retry with temporary deciding which errors are worth retrying
+func (p RetryPolicy) retryWhile(op string, temporary func(error) bool, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < p.Attempts; attempt++ {
+		if attempt > 0 {
+			wait := p.delay(attempt - 1)
+			fmt.Printf("%s failed (%v), retrying in %v\n", op, err, wait)
+			time.Sleep(wait)
+		}
+		err = fn()
+		if err == nil || !temporary(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %w: %w", op, ErrRetriesExhausted, err)
+}
+
+func request(url string, client *http.Client) ([]byte, error) {
+
+	resp, err := client.Get(url)
 	if err != nil {
-		fmt.Println("Could not get " + url)
-		os.Exit(1)
+		return nil, &NetworkError{Op: "GET", URL: url, Err: err}
 	}
 	defer resp.Body.Close()
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	body := string(bodyBytes)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &NetworkError{Op: "GET", URL: url, Err: err}
+	}
 
 	if resp.StatusCode != 200 {
-		fmt.Println("Error:", body)
-		os.Exit(1)
+		return nil, &HTTPError{URL: url, StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	return body
+	return body, nil
+}
+
+// requestJSON GETs url with retries of the errors temporary allows and
+// decodes the body into v. It returns the body as the server sent it.
+func requestJSON(url string, v any, retry RetryPolicy, temporary func(error) bool) ([]byte, error) {
+	var raw []byte
+	client := retry.client()
+	err := retry.retryWhile("GET "+url, temporary, func() error {
+		body, err := request(url, client)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return &ProtocolError{URL: url, Err: err}
+		}
+		raw = body
+		return nil
+	})
+	return raw, err
 }
 
 type JoinResponse struct {
@@ -42,98 +183,194 @@ type WebSocketMessage struct {
 	GameOver bool
 }
 
-func joinGame(host string, id string, name string) JoinResponse {
+func joinGame(host string, id string, name string, retry RetryPolicy) (JoinResponse, error) {
 
 	url := "http://" + host + fmt.Sprintf("/join?id=%s&name=%s", id, name)
-	body := request(url)
 
+	// joining twice would take a second seat, so only retry what never got there
 	var response JoinResponse
-	json.Unmarshal([]byte(body), &response)
+	if _, err := requestJSON(url, &response, retry, notSent); err != nil {
+		return response, fmt.Errorf("join game %s: %w", id, err)
+	}
 
 	fmt.Printf("Joined game %s as player %d\n", id, response.Id)
 
-	return response
+	return response, nil
 }
 
-func startWebSocket(host string, id string) *websocket.Conn {
+func startWebSocket(host string, id string, retry RetryPolicy) (*websocket.Conn, error) {
 
 	url := "ws://" + host + fmt.Sprintf("/ws?id=%s", id)
 
-	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
-
-	if err != nil {
-		fmt.Println("Websocket error: ", err)
-		os.Exit(1)
-	}
+	var ws *websocket.Conn
+	err := retry.retry("dial "+url, func() error {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+				return &HTTPError{URL: url, StatusCode: resp.StatusCode, Body: resp.Status}
+			}
+			return &NetworkError{Op: "dial", URL: url, Err: err}
+		}
+		ws = conn
+		return nil
+	})
 
-	return ws
+	return ws, err
 }
 
-func getState(host string, id string, token string) GameState {
+// getState returns the state, and the response it came in for the replay log
+func getState(host string, id string, token string, retry RetryPolicy) (GameState, []byte, error) {
 
 	url := "http://" + host + fmt.Sprintf("/game?id=%s&token=%s", id, token)
-	body := request(url)
 
 	var response GameState
-	json.Unmarshal([]byte(body), &response)
+	raw, err := requestJSON(url, &response, retry, isTemporary)
 
-	return response
+	return response, raw, err
 }
 
-func sendOrders(host string, id string, token string, orders []Order) {
+func sendOrders(host string, id string, token string, orders []Order, retry RetryPolicy) error {
 	url := "http://" + host + fmt.Sprintf("/orders?id=%s&token=%s", id, token)
 	payload, err := json.Marshal(orders)
-
-	resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
 	if err != nil {
-		fmt.Println("Could not post to " + url)
-		os.Exit(1)
+		return err
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	body := string(bodyBytes)
+	client := retry.client()
+	return retry.retry("POST "+url, func() error {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			return &NetworkError{Op: "POST", URL: url, Err: err}
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		fmt.Println("Error:", body)
-		os.Exit(1)
-	}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return &NetworkError{Op: "POST", URL: url, Err: err}
+		}
+
+		if resp.StatusCode != 200 {
+			return &HTTPError{URL: url, StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return nil
+	})
 }
 
-func Run(host string, id string, name string, callback func(*GameState, int) []Order) {
+// Run joins the game and plays it until the server reports game over.
+// A dropped websocket is re-dialled and the game resumed from the current
+// turn with the token we got from joining; only permanent failures are returned.
+// Requests are retried, and the socket re-dialled, as retry allows.
+// Each turn the strategy gets deadline to think, 0 means no limit.
+// Every turn is written to replay, if it isn't nil, and how the thinking went to trace.
+func Run(host string, id string, name string, retry RetryPolicy, deadline time.Duration, strategy Strategy, replay *ReplayLog, trace *Tracer) error {
 
-	playerInfo := joinGame(host, id, name)
-	ws := startWebSocket(host, id)
+	playerInfo, err := joinGame(host, id, name, retry)
+	if err != nil {
+		return err
+	}
+	ws, err := startWebSocket(host, id, retry)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ws != nil {
+			ws.Close()
+		}
+	}()
 	currentTurn := uint(0)
+	reconnects := 0 //in a row, since the last turn played
+	over := false   //the game ended, seen from a state rather than a message
+	turns := newTurnRunner(strategy, deadline, trace)
 
-	run := func() {
-		state := getState(host, id, playerInfo.Token)
+	run := func() error {
+		state, raw, err := getState(host, id, playerInfo.Token, retry)
+		if err != nil {
+			return fmt.Errorf("turn %d: %w", currentTurn+1, err)
+		}
+		if state.GameOver {
+			over = true // e.g. it ended while we were disconnected
+			return nil
+		}
+		if state.Turn <= currentTurn && currentTurn != 0 {
+			return nil // already played, e.g. a resume raced with the next message
+		}
 		currentTurn = state.Turn
-
-		orders := callback(&state, playerInfo.Id)
-		sendOrders(host, id, playerInfo.Token, orders)
-		if playerInfo.Id == 0 {
-//			gameMap.DumpToFile("map.txt")
+		reconnects = 0
+
+		orders := turns.play(&state, playerInfo.Id)
+		replay.Write(ReplayTurn{Turn: state.Turn, Player: playerInfo.Id, Raw: string(raw), Orders: orders, Think: turns.lastThink, Cut: turns.lastCut, Fallback: turns.lastFallback})
+		err = sendOrders(host, id, playerInfo.Token, orders, retry)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && !httpErr.Temporary() {
+			// rejected orders (e.g. too late for the turn) only cost us this turn
+			fmt.Printf("Turn %d: orders rejected: %v\n", state.Turn, err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("turn %d: %w", state.Turn, err)
 		}
+		return nil
 	}
 
 	for {
 		var message WebSocketMessage
 		err := ws.ReadJSON(&message)
 		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
+			fmt.Println("Websocket lost:", err)
+			ws.Close()
+			if reconnects++; reconnects > retry.Reconnects {
+				ws = nil
+				return fmt.Errorf("websocket dropped %d times without a turn played: %w", reconnects, ErrRetriesExhausted)
+			}
+			if ws, err = startWebSocket(host, id, retry); err != nil {
+				return fmt.Errorf("reconnect: %w", err)
+			}
+			// we may have missed the turn message while disconnected
+			if err := run(); err != nil {
+				return err
+			}
+			if over {
+				break
+			}
+			continue
 		}
 
 		if message.GameOver {
-			fmt.Println("Game is over")
 			break
 		} else if message.Turn > currentTurn {
 			// fmt.Printf("Starting turn %d\n", message.Turn)
-			run()
+			if err := run(); err != nil {
+				return err
+			}
+		}
+		if over {
+			break
 		}
 	}
-	if playerInfo.Id == 0 {
-		gameMap.DumpToFile("map.txt")
+	fmt.Println("Game is over")
+	return nil
+}
+
+// RunMany plays several games at once on the same server, one strategy and
+// replay log (nil for none) per game from newStrategy. It waits for all of
+// them, closes the logs and joins their errors.
+func RunMany(host string, ids []string, name string, retry RetryPolicy, deadline time.Duration, trace *Tracer, newStrategy func(id string) (Strategy, *ReplayLog)) error {
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			strategy, replay := newStrategy(id)
+			err := Run(host, id, name, retry, deadline, strategy, replay, trace.With("game", id))
+			if cerr := replay.Close(); cerr != nil {
+				fmt.Printf("Replay log for %s: %v\n", id, cerr)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("game %s: %w", id, err)
+			}
+		}()
 	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/patsastus/hive_arena_2025/arenamock"
+)
+
+import . "hive-arena/common"
+
+// mockTurns is how long the scripted games are
+const mockTurns = 5
+
+// testRetry keeps the tests quick: a few fast retries, a few re-dials, short timeouts
+var testRetry = RetryPolicy{Attempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Reconnects: 3, Timeout: 500 * time.Millisecond}
+
+// scriptedStates is a one player game with a bee on a flower field next to its hive
+func scriptedStates(turns int) []GameState {
+	states := make([]GameState, turns)
+	for i := range states {
+		states[i] = GameState{
+			NumPlayers: 1,
+			Hexes: map[Coords]*Hex{
+				{Row: 0, Col: 0}: {Terrain: FIELD, Resources: 5, Entity: &Entity{Type: BEE, Hp: 2, Player: 0}},
+				{Row: 0, Col: 2}: {Terrain: EMPTY, Entity: &Entity{Type: HIVE, Hp: 12, Player: 0}},
+				{Row: 1, Col: 1}: {Terrain: EMPTY},
+			},
+			PlayerResources: []uint{6},
+		}
+	}
+	return states
+}
+
+// forageStrategy forages with every bee it sees, straight away
+func forageStrategy(ctx context.Context, state *GameState, player int, out *OrderSet) {
+	for _, c := range sortedKeys(state.Hexes) {
+		if e := state.Hexes[c].Entity; e != nil && e.Type == BEE && e.Player == player {
+			out.Add(Order{Type: FORAGE, Coords: c})
+		}
+	}
+}
+
+// stuckStrategy never finishes in time and ignores ctx
+func stuckStrategy(d time.Duration) Strategy {
+	return func(ctx context.Context, state *GameState, player int, out *OrderSet) {
+		time.Sleep(d)
+	}
+}
+
+// playMock runs the client against a mock arena misbehaving as faults say,
+// and returns the server, for what it recorded, and what Run returned
+func playMock(t *testing.T, deadline time.Duration, strategy Strategy, faults ...arenamock.Fault) (*arenamock.Server, error) {
+	t.Helper()
+	t.Parallel()
+	s := arenamock.New(scriptedStates(mockTurns), 1)
+	for _, f := range faults {
+		s.Inject(f)
+	}
+	done := make(chan error, 1)
+	go func() { done <- Run(s.Host(), "check", "test", testRetry, deadline, strategy, nil, NoTrace()) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	s.Close()
+	return s, err
+}
+
+// everyTurnPlayed wants Run to end cleanly with one accepted submission a turn
+func everyTurnPlayed(t *testing.T, s *arenamock.Server, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	played := make(map[uint]bool)
+	for _, sub := range s.Submissions() {
+		if !sub.Late {
+			played[sub.Turn] = true
+		}
+	}
+	if len(played) != mockTurns {
+		t.Fatalf("orders for %d of %d turns", len(played), mockTurns)
+	}
+}
+
+func TestRunCleanGame(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy)
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunRetriesServerErrors(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy,
+		arenamock.Fault{Endpoint: "/game", Turn: 2, Times: 2, Status: http.StatusInternalServerError},
+		arenamock.Fault{Endpoint: "/orders", Turn: 3, Status: http.StatusServiceUnavailable},
+	)
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunRetriesMalformedState(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy, arenamock.Fault{Endpoint: "/game", Turn: 2, Malformed: true})
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunSlowResponses(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy,
+		arenamock.Fault{Endpoint: "/game", Turn: 2, Delay: 300 * time.Millisecond},
+		arenamock.Fault{Endpoint: "/orders", Turn: 4, Delay: 300 * time.Millisecond},
+	)
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunRedialsDroppedSocket(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy, arenamock.Fault{Endpoint: "/ws", Turn: 3, DropSocket: true})
+	if n := s.Requests("/ws"); n < 2 {
+		t.Fatalf("%d websocket dials, wanted a redial", n)
+	}
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunGivesUpOnHungUpSocket(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy,
+		arenamock.Fault{Endpoint: "/ws", Turn: 2, DropSocket: true},
+		arenamock.Fault{Endpoint: "/ws", Turn: 2, Times: 100, HangUp: true},
+		arenamock.Fault{Endpoint: "/orders", Turn: 2, Times: 100, Status: http.StatusBadRequest}, //so the game stays on turn 2
+	)
+	if !errors.Is(err, ErrRetriesExhausted) {
+		t.Fatalf("wanted ErrRetriesExhausted, got %v", err)
+	}
+	if n := s.Requests("/ws"); n > 2+testRetry.Reconnects {
+		t.Fatalf("%d websocket dials", n)
+	}
+}
+
+func TestRunDeadlineSendsFallback(t *testing.T) {
+	s, err := playMock(t, 100*time.Millisecond, stuckStrategy(400*time.Millisecond))
+	subs := s.Submissions()
+	if len(subs) == 0 {
+		t.Fatal("no orders sent")
+	}
+	first := subs[0]
+	if first.After > 300*time.Millisecond {
+		t.Fatalf("first orders took %v", first.After)
+	}
+	if len(first.Orders) == 0 || first.Orders[0].Type != FORAGE {
+		t.Fatalf("wanted a fallback FORAGE, got %v", first.Orders)
+	}
+	everyTurnPlayed(t, s, err)
+}
+
+func TestRunRefusedJoinIsNotRetried(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy, arenamock.Fault{Endpoint: "/join", Status: http.StatusNotFound})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wanted a 404 HTTPError, got %v", err)
+	}
+	if n := s.Requests("/join"); n != 1 {
+		t.Fatalf("join tried %d times", n)
+	}
+}
+
+func TestRunJoinIsNotRetriedOnceSent(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy, arenamock.Fault{Endpoint: "/join", Status: http.StatusInternalServerError})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("wanted a 500 HTTPError, got %v", err)
+	}
+	if n := s.Requests("/join"); n != 1 {
+		t.Fatalf("join tried %d times", n)
+	}
+}
+
+func TestRunTimesOutHungRequest(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy, arenamock.Fault{Endpoint: "/game", Turn: 2, Delay: 3 * testRetry.Timeout})
+	if n := s.Requests("/game"); n <= mockTurns {
+		t.Fatalf("%d state requests, wanted the hung one retried", n)
+	}
+	everyTurnPlayed(t, s, err)
+}
+
+// TestRunStopsWhenGameEndedWhileDisconnected drops the socket on the last
+// turn and redials too slowly to play it: Run sees the game is over and stops
+func TestRunStopsWhenGameEndedWhileDisconnected(t *testing.T) {
+	s, err := playMock(t, 0, forageStrategy,
+		arenamock.Fault{Endpoint: "/ws", Turn: mockTurns, DropSocket: true},
+		arenamock.Fault{Endpoint: "/ws", Turn: mockTurns, Delay: 2500 * time.Millisecond}, //past the mock's TurnTime
+	)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	for _, sub := range s.Submissions() {
+		if sub.Late {
+			t.Errorf("orders sent for turn %d after the game ended", sub.Turn)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+Task allocation: every turn the free foragers are matched to flower fields
+with the Hungarian algorithm. A field offers one slot per flower (at most
+maxPerField), each slot a bit more expensive than the last so bees spread out.
+A bee keeps its field from turn to turn unless another is clearly better.
+*/
+
+const (
+	maxPerField      = 3
+	congestionWeight = 2.0 // per bee already heading to the same field
+	richnessWeight   = 0.5 // per flower left in the field, capped at maxPerField*2
+	enemyWeight      = 4.0 // per enemy bee within 2 of the field
+	stickiness       = 3.0 // bonus for keeping last turn's field
+	noTaskCost       = 1e5 // cost of leaving a bee without a field
+	unreachableCost  = 1e6 // cost of a field the bee can't walk to
+)
+
+type TaskAllocator struct {
+	assigned map[int]Coords // bee ID -> field
+}
+
+func NewTaskAllocator() *TaskAllocator {
+	return &TaskAllocator{
+		assigned: make(map[int]Coords),
+	}
+}
+
+// fieldFor is the field the bee was given this turn
+func (t *TaskAllocator) fieldFor(bee *Bee) (Coords, bool) {
+	if bee == nil {
+		return Coords{}, false
+	}
+	field, ok := t.assigned[bee.ID]
+	return field, ok
+}
+
+// Allocate matches bees to flower fields, replacing last turn's assignment.
+// The field also becomes the bee's Task.
+func (t *TaskAllocator) Allocate(gm *GameMap, bees []*Bee) {
+	previous := t.assigned
+	t.assigned = make(map[int]Coords)
+
+	var fields []Coords
+	for field, there := range gm.FlowerFields {
+		if there {
+			fields = append(fields, field)
+		}
+	}
+	if len(bees) == 0 || len(fields) == 0 {
+		return
+	}
+	slices.SortFunc(fields, compareCoords)
+
+	type slot struct {
+		field Coords
+		extra float64
+	}
+	var slots []slot
+	for _, field := range fields {
+		tile := gm.Mapped[field]
+		bonus := richnessWeight * float64(min(tile.Flowers, 2*maxPerField))
+		danger := enemyWeight * float64(gm.enemiesNear(field, 2))
+		for k := 0; k < int(min(tile.Flowers, maxPerField)); k++ {
+			slots = append(slots, slot{field, congestionWeight*float64(k) - bonus + danger})
+		}
+	}
+
+	cost := make([][]float64, len(bees))
+	for i, bee := range bees {
+		walk := gm.buildField([]Coords{bee.Pos}, false, fieldWalkable)
+		row := make([]float64, len(slots)+len(bees)) //one "no task" column per bee
+		for j, s := range slots {
+			there, ok := walk[s.field]
+			if !ok {
+				row[j] = unreachableCost
+				continue
+			}
+			back := 0
+			if _, d, ok := gm.NearestHive(s.field); ok {
+				back = d
+			}
+			row[j] = float64(there.Dist+back) + s.extra
+			if last, ok := previous[bee.ID]; ok && last == s.field {
+				row[j] -= stickiness
+			}
+		}
+		for j := len(slots); j < len(row); j++ {
+			row[j] = noTaskCost
+		}
+		cost[i] = row
+	}
+
+	for i, j := range hungarian(cost) {
+		if j >= 0 && j < len(slots) && cost[i][j] < unreachableCost {
+			t.assigned[bees[i].ID] = slots[j].field
+			bees[i].Task = slots[j].field
+		}
+	}
+}
+
+func (gm *GameMap) enemiesNear(c Coords, radius int) int {
+	count := 0
+	for r := c.Row - radius; r <= c.Row+radius; r++ {
+		for col := c.Col - 2*radius; col <= c.Col+2*radius; col++ {
+			hex := Coords{Row: r, Col: col}
+			if dist(hex, c) <= radius && gm.Mapped[hex].Type == ENEMY_BEE {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+/*
+hungarian solves the assignment problem: the column for each row that
+minimises the total cost, each column used at most once. Needs at least as
+many columns as rows. O(rows^2 * cols), potentials version from e-maxx.
+*/
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 {
+		return nil
+	}
+	m := len(cost[0])
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1) // row matched to each column, 1-based, 0 is free
+	way := make([]int, m+1)
+	minv := make([]float64, m+1)
+	used := make([]bool, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		for j := range minv {
+			minv[j] = math.Inf(1)
+			used[j] = false
+		}
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := cost[i0-1][j-1] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 { //flip the augmenting path
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+	assign := make([]int, n)
+	for i := range assign {
+		assign[i] = -1
+	}
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			assign[p[j]-1] = j - 1
+		}
+	}
+	return assign
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// bruteAssign is the cheapest assignment of rows to distinct columns, by trying them all
+func bruteAssign(cost [][]float64) float64 {
+	best := math.Inf(1)
+	used := make([]bool, len(cost[0]))
+	var try func(row int, total float64)
+	try = func(row int, total float64) {
+		if row == len(cost) {
+			best = min(best, total)
+			return
+		}
+		for j := range used {
+			if !used[j] {
+				used[j] = true
+				try(row+1, total+cost[row][j])
+				used[j] = false
+			}
+		}
+	}
+	try(0, 0)
+	return best
+}
+
+// TestHungarian checks the matching against brute force on small random
+// matrices, with ties and with more columns than rows
+func TestHungarian(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 300; trial++ {
+		rows := 1 + rng.Intn(5)
+		cols := rows + rng.Intn(3)
+		cost := make([][]float64, rows)
+		for i := range cost {
+			cost[i] = make([]float64, cols)
+			for j := range cost[i] {
+				if trial%2 == 0 {
+					cost[i][j] = float64(rng.Intn(4)) //plenty of ties
+				} else {
+					cost[i][j] = rng.Float64() * 100
+				}
+			}
+		}
+
+		assign := hungarian(cost)
+		if len(assign) != rows {
+			t.Fatalf("%v: %d assignments for %d rows", cost, len(assign), rows)
+		}
+		taken := map[int]bool{}
+		total := 0.0
+		for i, j := range assign {
+			if j < 0 || j >= cols || taken[j] {
+				t.Fatalf("%v: row %d gets column %d in %v", cost, i, j, assign)
+			}
+			taken[j] = true
+			total += cost[i][j]
+		}
+		if want := bruteAssign(cost); math.Abs(total-want) > 1e-9 {
+			t.Errorf("%v: %v costs %v, best is %v", cost, assign, total, want)
+		}
+	}
+	if hungarian(nil) != nil {
+		t.Error("assignment for no rows")
+	}
+}
@@ -0,0 +1,368 @@
+// Package arenamock is a fake arena server for trying the client offline. It
+// serves /newgame, /join, /ws, /game and /orders like the real one, plays a scripted
+// list of game states, records the orders it gets and can be told to misbehave.
+package arenamock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+import . "hive-arena/common"
+
+// WebSocketMessage is what the server sends at the start of every turn
+type WebSocketMessage struct {
+	Turn     uint
+	GameOver bool
+}
+
+// GameID is the id /newgame hands out, for the one game the server plays
+const GameID = "mock"
+
+type JoinResponse struct {
+	Id    int
+	Token string
+}
+
+// Fault makes the server misbehave on an endpoint ("/newgame", "/join", "/ws",
+// "/game", "/orders"). Turn 0 matches any turn; the fault is used up after Times hits.
+type Fault struct {
+	Endpoint   string
+	Turn       uint
+	Times      int
+	Delay      time.Duration // answer this much later
+	Status     int           // answer with this status instead
+	Malformed  bool          // answer 200 with broken JSON
+	DropSocket bool          // /ws only: close the socket instead of sending the turn
+	HangUp     bool          // /ws only: accept the socket and close it straight away
+}
+
+// Submission is one POST to /orders
+type Submission struct {
+	Turn   uint
+	Player int
+	Orders []Order
+	After  time.Duration // since the turn started
+	Late   bool          // came after the turn was over, and was refused
+}
+
+type Server struct {
+	*httptest.Server
+	Players  int
+	TurnTime time.Duration // how long a turn waits for everybody's orders
+
+	mu          sync.Mutex
+	states      []GameState
+	turn        uint // 0 until the game starts
+	over        bool
+	turnStart   time.Time
+	joined      int
+	conns       []*websocket.Conn
+	faults      []*Fault
+	submissions []Submission
+	submitted   map[int]bool
+	requests    map[string]int
+	ready       chan struct{} // closed once everybody has joined and connected
+	orders      chan struct{} // pinged on every accepted submission
+	done        chan struct{}
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+// New starts a server that plays states as turns 1, 2, ... for players
+// players. The game begins once all of them have joined and opened a socket.
+func New(states []GameState, players int) *Server {
+	s := &Server{
+		Players:   players,
+		TurnTime:  2 * time.Second,
+		states:    states,
+		submitted: make(map[int]bool),
+		requests:  make(map[string]int),
+		ready:     make(chan struct{}),
+		orders:    make(chan struct{}, 64),
+		done:      make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/newgame", s.handleNewgame)
+	mux.HandleFunc("/join", s.handleJoin)
+	mux.HandleFunc("/ws", s.handleWS)
+	mux.HandleFunc("/game", s.handleGame)
+	mux.HandleFunc("/orders", s.handleOrders)
+	s.Server = httptest.NewServer(mux)
+	go s.play()
+	return s
+}
+
+// Host is what the client takes as its host argument
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	s.faults = append(s.faults, &f)
+}
+
+// Submissions is every order POST so far, late ones included
+func (s *Server) Submissions() []Submission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Submission(nil), s.submissions...)
+}
+
+// Requests is how many requests an endpoint has had
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// Done is closed when the last turn is over and game over has been sent
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+// fault finds and uses up the fault for a request, or with drop for a turn
+// message about to be sent, if there is one. Call with mu held.
+func (s *Server) fault(endpoint string, drop bool) *Fault {
+	if !drop {
+		s.requests[endpoint]++
+	}
+	for i, f := range s.faults {
+		if f.Endpoint == endpoint && f.DropSocket == drop && (f.Turn == 0 || f.Turn == s.turn) {
+			f.Times--
+			if f.Times <= 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			return f
+		}
+	}
+	return nil
+}
+
+// misbehave answers the request as the fault says; false if the handler should carry on
+func misbehave(w http.ResponseWriter, f *Fault) bool {
+	if f == nil {
+		return false
+	}
+	time.Sleep(f.Delay)
+	switch {
+	case f.Status != 0:
+		http.Error(w, "injected fault", f.Status)
+		return true
+	case f.Malformed:
+		w.Write([]byte(`{"Turn": 3, "Hexes": {`))
+		return true
+	}
+	return false
+}
+
+func (s *Server) player(r *http.Request) (int, bool) {
+	token := r.URL.Query().Get("token")
+	id, err := strconv.Atoi(strings.TrimPrefix(token, "token-"))
+	if err != nil || !strings.HasPrefix(token, "token-") || id < 0 || id >= s.joined {
+		return 0, false
+	}
+	return id, true
+}
+
+// handleNewgame "creates" the game the server was started with, for as many
+// players as it has
+func (s *Server) handleNewgame(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.fault("/newgame", false)
+	s.mu.Unlock()
+	if misbehave(w, f) {
+		return
+	}
+
+	if r.URL.Query().Get("players") != strconv.Itoa(s.Players) {
+		http.Error(w, "wrong number of players", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		ID string `json:"id"`
+	}{GameID})
+}
+
+func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.fault("/join", false)
+	s.mu.Unlock()
+	if misbehave(w, f) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.joined >= s.Players {
+		http.Error(w, "game is full", http.StatusForbidden)
+		return
+	}
+	id := s.joined
+	s.joined++
+	json.NewEncoder(w).Encode(JoinResponse{Id: id, Token: fmt.Sprintf("token-%d", id)})
+}
+
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.fault("/ws", false)
+	s.mu.Unlock()
+	if misbehave(w, f) {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	if f != nil && f.HangUp {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	if s.turn == 0 && s.joined == s.Players && len(s.conns) >= s.Players {
+		select {
+		case <-s.ready:
+		default:
+			close(s.ready)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) handleGame(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.fault("/game", false)
+	s.mu.Unlock()
+	if misbehave(w, f) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.player(r); !ok {
+		http.Error(w, "bad token", http.StatusForbidden)
+		return
+	}
+	if s.turn == 0 {
+		http.Error(w, "game has not started", http.StatusBadRequest)
+		return
+	}
+	state := s.states[s.turn-1]
+	state.Turn = s.turn
+	state.GameOver = s.over
+	json.NewEncoder(w).Encode(state)
+}
+
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	f := s.fault("/orders", false)
+	turn := s.turn
+	s.mu.Unlock()
+	if misbehave(w, f) {
+		return
+	}
+
+	var orders []Order
+	if err := json.NewDecoder(r.Body).Decode(&orders); err != nil {
+		http.Error(w, "bad orders: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	player, ok := s.player(r)
+	if !ok {
+		http.Error(w, "bad token", http.StatusForbidden)
+		return
+	}
+	sub := Submission{Turn: turn, Player: player, Orders: orders, After: time.Since(s.turnStart)}
+	if s.over || s.turn != turn || s.submitted[player] {
+		sub.Late = true
+		s.submissions = append(s.submissions, sub)
+		http.Error(w, "orders already in for this turn", http.StatusBadRequest)
+		return
+	}
+	s.submitted[player] = true
+	s.submissions = append(s.submissions, sub)
+	select {
+	case s.orders <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast sends msg to every open socket, dropping those a fault says to drop
+func (s *Server) broadcast(msg WebSocketMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	open := s.conns[:0]
+	for _, c := range s.conns {
+		if f := s.fault("/ws", true); f != nil {
+			c.Close()
+			continue
+		}
+		if err := c.WriteJSON(msg); err != nil {
+			c.Close()
+			continue
+		}
+		open = append(open, c)
+	}
+	s.conns = open
+}
+
+// play runs the turns: announce, wait for everybody's orders or TurnTime, next
+func (s *Server) play() {
+	defer close(s.done)
+	<-s.ready
+	for i := range s.states {
+		s.mu.Lock()
+		s.turn = uint(i + 1)
+		s.turnStart = time.Now()
+		clear(s.submitted)
+		s.mu.Unlock()
+		s.broadcast(WebSocketMessage{Turn: uint(i + 1)})
+
+		timeout := time.After(s.TurnTime)
+	wait:
+		for {
+			s.mu.Lock()
+			all := len(s.submitted) == s.Players
+			s.mu.Unlock()
+			if all {
+				break
+			}
+			select {
+			case <-s.orders:
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	s.mu.Lock()
+	s.over = true
+	s.mu.Unlock()
+	s.broadcast(WebSocketMessage{Turn: uint(len(s.states)), GameOver: true})
+}
@@ -1,21 +1,80 @@
 package main
 
-import "sort"
-import "fmt"
-import "math/rand"
+import (
+	"container/heap"
+	"slices"
+)
+
 import . "hive-arena/common"
 
 type Node struct {
-	hex 				Coords
-	cost, dist, total	int
-	prev				*Node
+	hex               Coords
+	cost, dist, total int
+	prev              *Node
+	index             int  // position in the open set, maintained by heap
+	closed            bool // never come back here
+}
+
+// openSet is a min-heap of candidate nodes ordered by total cost
+type openSet []*Node
+
+func (o openSet) Len() int { return len(o) }
+func (o openSet) Less(i, j int) bool {
+	if o[i].total == o[j].total {
+		return o[i].dist < o[j].dist // prefer nodes closer to the target on ties
+	}
+	return o[i].total < o[j].total
+}
+func (o openSet) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+	o[i].index = i
+	o[j].index = j
+}
+func (o *openSet) Push(x any) {
+	n := x.(*Node)
+	n.index = len(*o)
+	*o = append(*o, n)
+}
+func (o *openSet) Pop() any {
+	old := *o
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*o = old[:len(old)-1]
+	return n
+}
+
+// pathScratch is reused by every search on a GameMap so aStar doesn't
+// allocate once it has warmed up. Not safe for concurrent searches.
+type pathScratch struct {
+	nodes []Node // arena, each hex gets at most one node per search
+	open  openSet
+	seen  map[Coords]*Node
+}
+
+func newPathScratch() *pathScratch {
+	return &pathScratch{seen: make(map[Coords]*Node)}
+}
+
+func (s *pathScratch) reset(size int) {
+	if cap(s.nodes) < size {
+		s.nodes = make([]Node, 0, size*2) // pointers into nodes must stay valid, so never append past cap
+	}
+	s.nodes = s.nodes[:0]
+	s.open = s.open[:0]
+	clear(s.seen)
 }
 
-func sortByTotal(candidates []*Node) {
-    sort.Slice(candidates, func(i, j int) bool {
-        // We want the LOWEST total cost to be first (index 0)
-        return candidates[i].total < candidates[j].total
-    })
+func (s *pathScratch) node(hex Coords, cost, dist int, prev *Node) *Node {
+	s.nodes = append(s.nodes, Node{
+		hex:   hex,
+		cost:  cost,
+		dist:  dist,
+		total: cost + dist,
+		prev:  prev,
+	})
+	n := &s.nodes[len(s.nodes)-1]
+	s.seen[hex] = n
+	return n
 }
 
 func getCoords(loc Coords, dir Direction) Coords {
@@ -46,8 +105,8 @@ func getDirection(loc, target Coords) (Direction, bool) {
 func goTo(loc, targetHex Coords, myMap *GameMap) Order {
 	dir, found := getDirection(loc, targetHex)
 	if (!found) {
-		fmt.Println("goTo got invalid source/target combo")
-		dir = dirs[rand.Intn(len(dirs))]
+		myMap.trace.Of(SUB_PATH).Warn("goTo got invalid source/target combo", "from", loc, "to", targetHex)
+		dir = myMap.randomDir()
 	}
 	o := Order{
         Type: MOVE,
@@ -56,77 +115,84 @@ func goTo(loc, targetHex Coords, myMap *GameMap) Order {
     }
 	if myMap.Mapped[targetHex].Type == ENEMY_WALL {
 		o.Type = ATTACK
-	} else {
-		myMap.Targeted[targetHex] = true
 	}
 	return o
 }
 
+// Path is the result of a path query
+type Path struct {
+	Steps     []Coords // every hex from the start to the end, both included
+	Cost      int      // moves needed, walls count as the turns it takes to break them, plus the cost's extras
+	Reachable bool
+}
+
+// Next is the hex to step on this turn, or the start if there is nowhere to go
+func (p Path) Next() Coords {
+	if len(p.Steps) < 2 {
+		return p.Steps[0]
+	}
+	return p.Steps[1]
+}
+
 /*
-	A-* pathfinding algorithm
-	builds on https://reintech.io/blog/a-star-search-algorithm-in-go
-	and https://en.wikipedia.org/wiki/A*_search_algorithm
-	returns an order with the first step of the path
-	stopNextTo is so you can go to non-walkable target (hive, wall, enemy) == true, or walkable space(empty, field) == false
-	also return total distance ?
+A-* pathfinding algorithm
+builds on https://reintech.io/blog/a-star-search-algorithm-in-go
+and https://en.wikipedia.org/wiki/A*_search_algorithm
+returns the whole path from loc and what it costs
+stopNextTo is so you can go to non-walkable target (hive, wall, enemy) == true, or walkable space(empty, field) == false
+cost prices the hexes on the way, see pathcost.go
+the open set is a binary heap and the nodes come from the map's scratch arena
 */
-func aStar(loc, target Coords, stopNextTo bool, myMap *GameMap) Order {
-	startNode := &Node{
-		hex:	loc,
-		cost:	0,
-		dist:	dist(loc, target),
-		total:	dist(loc, target),
-		prev:	nil,
+func (gm *GameMap) FindPath(loc, target Coords, stopNextTo bool, cost PathCost) Path {
+	if gm.scratch == nil {
+		gm.scratch = newPathScratch()
 	}
-	candidates := []*Node{startNode}
-	candidateMap := map[Coords]*Node{loc: startNode}
-	rejects	:= make(map[Coords]bool)
-	for len(candidates) > 0 { //Use a for-loop as a while-loop
-		sortByTotal(candidates)
-		current := candidates[0]
-		candidates = candidates[1:]
-		delete(candidateMap, current.hex)
-
-		atTarget := current.hex == target //on the target square
+	s := gm.scratch
+	s.reset(len(gm.Mapped) + 1)
+
+	heap.Push(&s.open, s.node(loc, 0, dist(loc, target), nil))
+	for s.open.Len() > 0 {
+		current := heap.Pop(&s.open).(*Node)
+		current.closed = true
+
+		atTarget := current.hex == target                            //on the target square
 		nextToTarget := stopNextTo && dist(current.hex, target) == 1 //target isn't walkable and next to it
-		if atTarget || nextToTarget { //loop back to the first step
-			for current.prev != nil && current.prev.hex != loc { current = current.prev }
-			return goTo(loc, current.hex, myMap)
+		if atTarget || nextToTarget {                                //walk back to the start
+			path := Path{Cost: current.cost, Reachable: true}
+			for n := current; n != nil; n = n.prev {
+				path.Steps = append(path.Steps, n.hex)
+			}
+			slices.Reverse(path.Steps)
+			return path
 		}
 
-		rejects[current.hex] = true //never come back here
-		for _, offset := range DirectionToOffset {
-			neighborCoords := Coords{
-				Row: current.hex.Row + offset.Row,
-				Col: current.hex.Col + offset.Col,
-    		}
-			neighborGMO := myMap.Mapped[neighborCoords]
-			if (neighborGMO == (GameMapObject{}) ||
-				myMap.Targeted[neighborCoords] ||
-				!(neighborGMO.Type == EMPTY_HEX || neighborGMO.Type == ENEMY_WALL)) { 
-				continue 
+		for _, dir := range dirs { //in a fixed order, so ties always break the same way
+			neighborCoords := getCoords(current.hex, dir)
+			neighborGMO := gm.Mapped[neighborCoords]
+			if neighborGMO == (GameMapObject{}) || !cost.enters(neighborGMO) {
+				continue
 			}
-			if rejects[neighborCoords] { continue }
-			neighborCost := current.cost + 1
-			if neighborGMO.Type == ENEMY_WALL { neighborCost += 6 }
-			cand, exists := candidateMap[neighborCoords] //looks for the candidate coordinates in the candidate map (exists is a bool whether the key was found, cand is a Coord struct that is either a value or nil
-			if exists { //if location was already in candidates, check and update if better than old version
-				if neighborCost >= cand.cost { continue }
-				cand.prev = current
-				cand.cost = neighborCost
-				cand.total = cand.cost + cand.dist
-			} else {
-				newNode := &Node{
-					hex: neighborCoords,
-					cost: neighborCost,
-					dist: dist(neighborCoords, target),
-					prev: current,
-				}
-				newNode.total = newNode.cost + newNode.dist
-				candidates = append(candidates, newNode)
-				candidateMap[neighborCoords] = newNode
+			neighborCost := current.cost + gm.enterCost(neighborGMO) + cost.extra(gm, loc, neighborCoords)
+			cand, exists := s.seen[neighborCoords]
+			if !exists {
+				heap.Push(&s.open, s.node(neighborCoords, neighborCost, dist(neighborCoords, target), current))
+				continue
 			}
+			if cand.closed || neighborCost >= cand.cost {
+				continue
+			}
+			cand.prev = current //cheaper way to an open candidate, move it up the heap
+			cand.cost = neighborCost
+			cand.total = cand.cost + cand.dist
+			heap.Fix(&s.open, cand.index)
 		}
 	}
-	return Order{}
+	return Path{Steps: []Coords{loc}}
+}
+
+// aStar returns the order for this turn's step towards target, planned around
+// the bees that were given orders before this one (see coop.go), at cost.
+// ok is false when there is no way there; an empty order with ok means wait.
+func aStar(loc, target Coords, stopNextTo bool, cost PathCost, myMap *GameMap) (Order, bool) {
+	return myMap.planStep(loc, target, stopNextTo, cost)
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// benchMap builds a rows x cols (in hexes) map with rock walls, flower fields
+// and a swarm of our bees spread over it, for timing path queries.
+func benchMap(rows, cols, bees int, seed int64) (GameMap, []Coords) {
+	rng := rand.New(rand.NewSource(seed))
+	gm := NewGameMap()
+	for r := 0; r < rows; r++ {
+		for i := 0; i < cols; i++ {
+			c := Coords{Row: r, Col: 2*i + r%2}
+			tile := GameMapObject{Type: EMPTY_HEX, IsWalkable: true}
+			switch roll := rng.Intn(100); {
+			case roll < 15:
+				tile = GameMapObject{Type: ROCK_HEX}
+			case roll < 22:
+				tile.IsFlowerField = true
+				tile.Flowers = uint(1 + rng.Intn(5))
+				gm.FlowerFields[c] = true
+			}
+			gm.Mapped[c] = tile
+		}
+	}
+	var positions []Coords
+	for len(positions) < bees {
+		r := rng.Intn(rows)
+		c := Coords{Row: r, Col: 2*rng.Intn(cols) + r%2}
+		if gm.Mapped[c].Type != EMPTY_HEX {
+			continue
+		}
+		gm.Mapped[c] = GameMapObject{Type: OWN_BEE, IsWalkable: true, Player: 0}
+		gm.MyBees[c] = &Hex{}
+		positions = append(positions, c)
+	}
+	return gm, positions
+}
+
+// one simulated turn: every bee asks for a path to a far away flower field
+func benchTurn(gm *GameMap, bees []Coords, targets []Coords, search func(Coords, Coords, bool, *GameMap)) {
+	for i, bee := range bees {
+		search(bee, targets[i], false, gm)
+	}
+}
+
+// benchTargets sends every bee to the flower field furthest from it, so the
+// search has to cover most of the map
+func benchTargets(gm *GameMap, bees []Coords) []Coords {
+	var fields []Coords
+	for field := range gm.FlowerFields {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Row < fields[j].Row || (fields[i].Row == fields[j].Row && fields[i].Col < fields[j].Col)
+	})
+	targets := make([]Coords, len(bees))
+	for i, bee := range bees {
+		for _, field := range fields {
+			if dist(bee, field) > dist(bee, targets[i]) {
+				targets[i] = field
+			}
+		}
+	}
+	return targets
+}
+
+// benchSearch times search on a 1600 hex map with 36 bees, one op being one
+// turn of path queries
+func benchSearch(b *testing.B, search func(gm *GameMap, bees []Coords, loc, target Coords)) {
+	gm, bees := benchMap(40, 40, 36, 1)
+	targets := benchTargets(&gm, bees)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchTurn(&gm, bees, targets, func(loc, target Coords, stop bool, gm *GameMap) { search(gm, bees, loc, target) })
+	}
+}
+
+// wallMap is three rows with a barrier across the middle: rock on rows 1 and
+// 2 and barrier on row 0. Walking around it from 0,0 to 0,8 takes 6 moves,
+// straight through 4.
+func wallMap(barrier GameMapObjectType) GameMap {
+	gm := openMap(3, 7)
+	gm.Mapped[Coords{Row: 0, Col: 4}] = GameMapObject{Type: barrier}
+	gm.Mapped[Coords{Row: 1, Col: 3}] = GameMapObject{Type: ROCK_HEX}
+	gm.Mapped[Coords{Row: 1, Col: 5}] = GameMapObject{Type: ROCK_HEX}
+	return gm
+}
+
+func TestFindPath(t *testing.T) {
+	from, to := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 8}
+	rock, wall := wallMap(ROCK_HEX), wallMap(ENEMY_WALL)
+	tests := []struct {
+		name       string
+		gm         *GameMap
+		target     Coords
+		stopNextTo bool
+		cost       int
+		steps      int // moves, walls included
+	}{
+		{"around the rock", &rock, to, false, 6, 6},
+		{"through the wall if it is cheaper", &wall, to, false, min(6, 4+wall.params.WallCost), -1},
+		{"next to the rock", &rock, Coords{Row: 0, Col: 4}, true, 1, 1},
+		{"onto the start", &rock, from, false, 0, 0},
+	}
+	for _, tt := range tests {
+		p := tt.gm.FindPath(from, tt.target, tt.stopNextTo, UniformCost)
+		if !p.Reachable || p.Cost != tt.cost || tt.steps >= 0 && len(p.Steps)-1 != tt.steps {
+			t.Errorf("%s: %v costs %d, want %d", tt.name, p.Steps, p.Cost, tt.cost)
+			continue
+		}
+		if p.Steps[0] != from {
+			t.Errorf("%s: %v does not start at %v", tt.name, p.Steps, from)
+		}
+		for i := 1; i < len(p.Steps); i++ {
+			if dist(p.Steps[i-1], p.Steps[i]) != 1 || !UniformCost.enters(tt.gm.Mapped[p.Steps[i]]) {
+				t.Errorf("%s: %v makes a bad step onto %v", tt.name, p.Steps, p.Steps[i])
+			}
+		}
+	}
+
+	closed := openMap(3, 7)
+	for _, dir := range dirs {
+		closed.Mapped[getCoords(to, dir)] = GameMapObject{Type: ROCK_HEX}
+	}
+	if p := closed.FindPath(from, to, false, UniformCost); p.Reachable || len(p.Steps) != 1 || p.Next() != from {
+		t.Errorf("walled in target: %+v, want unreachable, staying at %v", p, from)
+	}
+}
+
+func BenchmarkFindPath(b *testing.B) {
+	benchSearch(b, func(gm *GameMap, bees []Coords, loc, target Coords) { gm.FindPath(loc, target, false, UniformCost) })
+}
+
+// BenchmarkSortedAStar is the baseline BenchmarkFindPath replaced
+func BenchmarkSortedAStar(b *testing.B) {
+	benchSearch(b, func(gm *GameMap, bees []Coords, loc, target Coords) { sortedAStar(loc, target, false, gm) })
+}
+
+// BenchmarkCooperative plans every bee around the ones planned before it
+func BenchmarkCooperative(b *testing.B) {
+	benchSearch(b, func(gm *GameMap, bees []Coords, loc, target Coords) {
+		if loc == bees[0] {
+			gm.Reserved.Reset(gm.MyBees)
+		}
+		aStar(loc, target, false, UniformCost, gm)
+	})
+}
+
+// sortedAStar is the original aStar that re-sorts the whole candidate list on
+// every pop, kept as the baseline for BenchmarkFindPath.
+func sortedAStar(loc, target Coords, stopNextTo bool, myMap *GameMap) Order {
+	startNode := &Node{
+		hex:   loc,
+		cost:  0,
+		dist:  dist(loc, target),
+		total: dist(loc, target),
+		prev:  nil,
+	}
+	candidates := []*Node{startNode}
+	candidateMap := map[Coords]*Node{loc: startNode}
+	rejects := make(map[Coords]bool)
+	for len(candidates) > 0 {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].total < candidates[j].total
+		})
+		current := candidates[0]
+		candidates = candidates[1:]
+		delete(candidateMap, current.hex)
+
+		atTarget := current.hex == target
+		nextToTarget := stopNextTo && dist(current.hex, target) == 1
+		if atTarget || nextToTarget {
+			for current.prev != nil && current.prev.hex != loc {
+				current = current.prev
+			}
+			return goTo(loc, current.hex, myMap)
+		}
+
+		rejects[current.hex] = true
+		for _, offset := range DirectionToOffset {
+			neighborCoords := Coords{
+				Row: current.hex.Row + offset.Row,
+				Col: current.hex.Col + offset.Col,
+			}
+			neighborGMO := myMap.Mapped[neighborCoords]
+			if neighborGMO == (GameMapObject{}) ||
+				!(neighborGMO.Type == EMPTY_HEX || neighborGMO.Type == ENEMY_WALL) {
+				continue
+			}
+			if rejects[neighborCoords] {
+				continue
+			}
+			neighborCost := current.cost + 1
+			if neighborGMO.Type == ENEMY_WALL {
+				neighborCost += 6
+			}
+			cand, exists := candidateMap[neighborCoords]
+			if exists {
+				if neighborCost >= cand.cost {
+					continue
+				}
+				cand.prev = current
+				cand.cost = neighborCost
+				cand.total = cand.cost + cand.dist
+			} else {
+				newNode := &Node{
+					hex:  neighborCoords,
+					cost: neighborCost,
+					dist: dist(neighborCoords, target),
+					prev: current,
+				}
+				newNode.total = newNode.cost + newNode.dist
+				candidates = append(candidates, newNode)
+				candidateMap[neighborCoords] = newNode
+			}
+		}
+	}
+	return Order{}
+}
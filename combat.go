@@ -0,0 +1,374 @@
+package main
+
+import (
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+Combat follows the arena's rules (see arenaRules in rules.go): an attack takes
+AttackDamage off the unit next to the attacker, a unit at 0 hp is gone and a
+bee carrying a flower loses it with its life. Orders resolve one at a time,
+the players taking turns, so who strikes first matters and a bee killed early
+never strikes back.
+
+Every turn the bees in contact are grouped into skirmishes and each one is
+played out a few turns ahead, half the time with us striking first. When the
+trade is worth it (bees at what they cost to spawn, flowers at one) bees next
+to enemies focus fire on the weakest and bees a step away close in; when it
+isn't, bees that are free to retreat do.
+*/
+
+const (
+	contactRange  = 3 // bees this close are in the same skirmish
+	skirmishTurns = 3 // turns a skirmish is played ahead
+)
+
+// Fighter is a bee in a skirmish
+type Fighter struct {
+	At     Coords
+	Hp     int
+	Flower bool
+	Fights bool // strikes back; our flower carriers keep walking
+}
+
+// Skirmish is the bees of both sides close enough to fight over the next turns
+type Skirmish struct {
+	Ours, Theirs []Fighter
+}
+
+// Outcome is what a skirmish is expected to cost each side
+type Outcome struct {
+	OurLosses, TheirLosses     float64 // bees
+	FlowersLost, FlowersDenied float64 // carried flowers that die with their bee
+}
+
+// Value is the trade in resources, positive when it goes our way
+func (o Outcome) Value() float64 {
+	spawn := float64(arenaRules.SpawnCost)
+	return (o.TheirLosses*spawn + o.FlowersDenied) - (o.OurLosses*spawn + o.FlowersLost)
+}
+
+// hitsToKill is how many attacks it takes to destroy a unit with hp
+func hitsToKill(hp int) int {
+	return (hp + arenaRules.AttackDamage - 1) / arenaRules.AttackDamage
+}
+
+// Predict plays the skirmish out for turns, averaged over who strikes first
+func (s Skirmish) Predict(turns int) Outcome {
+	a, b := s.play(turns, true), s.play(turns, false)
+	return Outcome{
+		OurLosses:     (a.OurLosses + b.OurLosses) / 2,
+		TheirLosses:   (a.TheirLosses + b.TheirLosses) / 2,
+		FlowersLost:   (a.FlowersLost + b.FlowersLost) / 2,
+		FlowersDenied: (a.FlowersDenied + b.FlowersDenied) / 2,
+	}
+}
+
+// play is one way the skirmish could go: bees don't move, except that after
+// the first turn everyone within two hexes of an enemy has closed in, and
+// every bee hits the weakest enemy it can reach
+func (s Skirmish) play(turns int, oursFirst bool) Outcome {
+	ours, theirs := slices.Clone(s.Ours), slices.Clone(s.Theirs)
+	strike := func(attackers, defenders []Fighter, reach int) {
+		for _, f := range attackers {
+			if f.Hp <= 0 || !f.Fights {
+				continue
+			}
+			if t := weakestInReach(defenders, f.At, reach); t >= 0 {
+				defenders[t].Hp -= arenaRules.AttackDamage
+			}
+		}
+	}
+	for turn := 0; turn < turns; turn++ {
+		reach := 1
+		if turn > 0 {
+			reach = 2
+		}
+		if oursFirst {
+			strike(ours, theirs, reach)
+			strike(theirs, ours, reach)
+		} else {
+			strike(theirs, ours, reach)
+			strike(ours, theirs, reach)
+		}
+	}
+	var o Outcome
+	for _, f := range ours {
+		if f.Hp <= 0 {
+			o.OurLosses++
+			if f.Flower {
+				o.FlowersLost++
+			}
+		}
+	}
+	for _, f := range theirs {
+		if f.Hp <= 0 {
+			o.TheirLosses++
+			if f.Flower {
+				o.FlowersDenied++
+			}
+		}
+	}
+	return o
+}
+
+// weakestInReach is the living fighter within reach of c that dies soonest, -1 for none
+func weakestInReach(fighters []Fighter, c Coords, reach int) int {
+	best := -1
+	for i, f := range fighters {
+		if f.Hp <= 0 || dist(c, f.At) > reach {
+			continue
+		}
+		if best < 0 || f.Hp < fighters[best].Hp || f.Hp == fighters[best].Hp && f.Flower && !fighters[best].Flower {
+			best = i
+		}
+	}
+	return best
+}
+
+type EngageKind int
+
+const (
+	ENGAGE_ATTACK  EngageKind = iota // hit Target, next to us
+	ENGAGE_GANK                      // close in on Target to hit it next turn
+	ENGAGE_RETREAT                   // get away from the enemies around
+)
+
+// Engagement is what the planner wants a bee in contact to do this turn
+type Engagement struct {
+	Kind      EngageKind
+	Target    Coords
+	HasTarget bool     // a retreat keeps the target of the attack it replaced
+	Outcome   Outcome  // of the bee's skirmish
+	Enemies   []Coords // in the skirmish
+}
+
+// skirmishes groups the bees in contact, ours and theirs, and returns each
+// skirmish with our bees in it
+func (gm *GameMap) skirmishes(state *GameState, player int) ([]Skirmish, [][]*Bee) {
+	var enemies []Fighter
+	for _, c := range sortedKeys(state.Hexes) {
+		if unit := state.Hexes[c].Entity; unit != nil && unit.Type == BEE && unit.Player != player {
+			enemies = append(enemies, Fighter{At: c, Hp: unit.Hp, Flower: unit.HasFlower, Fights: true})
+		}
+	}
+	if len(enemies) == 0 {
+		return nil, nil
+	}
+	bees := gm.Tracker.sorted()
+
+	//union-find over our bees (0..len(bees)-1) and the enemies after them
+	parent := make([]int, len(bees)+len(enemies))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	pos := func(i int) Coords {
+		if i < len(bees) {
+			return bees[i].Pos
+		}
+		return enemies[i-len(bees)].At
+	}
+	inContact := make([]bool, len(parent))
+	for i := range bees {
+		for j := range enemies {
+			if dist(bees[i].Pos, enemies[j].At) <= contactRange {
+				inContact[i], inContact[len(bees)+j] = true, true
+				parent[find(i)] = find(len(bees) + j)
+			}
+		}
+	}
+	for i := range parent { //bees on the same side near each other fight together too
+		for j := i + 1; j < len(parent); j++ {
+			if inContact[i] && inContact[j] && (i < len(bees)) == (j < len(bees)) && dist(pos(i), pos(j)) <= 1 {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	index := map[int]int{}
+	var skirmishes []Skirmish
+	var members [][]*Bee
+	group := func(i int) int {
+		root := find(i)
+		if k, ok := index[root]; ok {
+			return k
+		}
+		index[root] = len(skirmishes)
+		skirmishes = append(skirmishes, Skirmish{})
+		members = append(members, nil)
+		return index[root]
+	}
+	for i, bee := range bees {
+		if !inContact[i] {
+			continue
+		}
+		k := group(i)
+		skirmishes[k].Ours = append(skirmishes[k].Ours, Fighter{At: bee.Pos, Hp: state.Hexes[bee.Pos].Entity.Hp, Flower: bee.HasFlower, Fights: !bee.HasFlower})
+		members[k] = append(members[k], bee)
+	}
+	for j, e := range enemies {
+		if inContact[len(bees)+j] {
+			k := group(len(bees) + j)
+			skirmishes[k].Theirs = append(skirmishes[k].Theirs, e)
+		}
+	}
+	return skirmishes, members
+}
+
+// planEngagements decides, for every bee in contact with enemies, to attack,
+// close in, retreat or carry on with its role
+func (gm *GameMap) planEngagements(state *GameState, player int) {
+	clear(gm.engagements)
+	skirmishes, members := gm.skirmishes(state, player)
+	for k, s := range skirmishes {
+		outcome := s.Predict(skirmishTurns)
+		var enemies []Coords
+		for _, f := range s.Theirs {
+			enemies = append(enemies, f.At)
+		}
+		worth := outcome.Value() >= gm.params.EngageMargin
+		gm.trace.Of(SUB_COMBAT).Debug("skirmish", "ours", len(s.Ours), "theirs", len(s.Theirs),
+			"ourLosses", outcome.OurLosses, "theirLosses", outcome.TheirLosses, "value", outcome.Value(), "fight", worth)
+
+		//focus fire: the enemy that dies soonest first, with as many bees as it takes
+		targets := slices.Clone(s.Theirs)
+		slices.SortStableFunc(targets, func(a, b Fighter) int {
+			if hitsToKill(a.Hp) != hitsToKill(b.Hp) {
+				return hitsToKill(a.Hp) - hitsToKill(b.Hp)
+			}
+			if a.Flower != b.Flower {
+				if a.Flower {
+					return -1
+				}
+				return 1
+			}
+			return compareCoords(a.At, b.At)
+		})
+		damage := map[Coords]int{}
+		assign := func(bee *Bee, saturate bool) bool {
+			for _, t := range targets {
+				if dist(bee.Pos, t.At) != 1 || saturate && damage[t.At] >= t.Hp {
+					continue
+				}
+				damage[t.At] += arenaRules.AttackDamage
+				gm.engagements[bee.ID] = Engagement{Kind: ENGAGE_ATTACK, Target: t.At, HasTarget: true, Outcome: outcome, Enemies: enemies}
+				return true
+			}
+			return false
+		}
+		var spare []*Bee
+		for _, bee := range members[k] {
+			if bee.HasFlower {
+				continue
+			}
+			if !assign(bee, true) {
+				spare = append(spare, bee)
+			}
+		}
+		for _, bee := range spare {
+			if assign(bee, false) { //everyone's target is covered, but one more hit covers bad luck
+				continue
+			}
+			near := -1
+			for i, t := range targets {
+				if dist(bee.Pos, t.At) == 2 && (near < 0 || damage[t.At] > damage[targets[near].At]) {
+					near = i
+				}
+			}
+			switch {
+			case worth && near >= 0:
+				gm.engagements[bee.ID] = Engagement{Kind: ENGAGE_GANK, Target: targets[near].At, HasTarget: true, Outcome: outcome, Enemies: enemies}
+			case !worth:
+				gm.engagements[bee.ID] = Engagement{Kind: ENGAGE_RETREAT, Outcome: outcome, Enemies: enemies}
+			}
+		}
+		if !worth { //not a fight to take, whoever is free to leave does
+			for _, bee := range members[k] {
+				if e, ok := gm.engagements[bee.ID]; ok && e.Kind == ENGAGE_ATTACK {
+					e.Kind = ENGAGE_RETREAT
+					gm.engagements[bee.ID] = e
+				}
+			}
+		}
+	}
+}
+
+// engageOrder is the bee's order from the engagement plan, if it has one that fits its role
+func (gm *GameMap) engageOrder(bee *Bee) (Order, bool) {
+	e, ok := gm.engagements[bee.ID]
+	if !ok {
+		return Order{}, false
+	}
+	switch e.Kind {
+	case ENGAGE_ATTACK:
+		if bee.Role == ROLE_BUILDER || bee.Role == ROLE_WALLER {
+			return Order{}, false
+		}
+		dir, _ := getDirection(bee.Pos, e.Target)
+		gm.note(bee, "focusing fire on %v (skirmish worth %.1f)", e.Target, e.Outcome.Value())
+		return Order{Type: ATTACK, Coords: bee.Pos, Direction: dir}, true
+	case ENGAGE_GANK:
+		if bee.Role != ROLE_FORAGER && bee.Role != ROLE_DEFENDER {
+			return Order{}, false
+		}
+		bee.Task = e.Target
+		gm.note(bee, "closing in on %v (skirmish worth %.1f)", e.Target, e.Outcome.Value())
+		order, _ := aStar(bee.Pos, e.Target, true, UniformCost, gm)
+		return order, true
+	case ENGAGE_RETREAT:
+		switch bee.Role {
+		case ROLE_FORAGER, ROLE_EXPLORER:
+		case ROLE_SABOTEUR, ROLE_DEFENDER: //they stand and fight
+			if e.HasTarget {
+				dir, _ := getDirection(bee.Pos, e.Target)
+				gm.note(bee, "holding on against %v in a losing skirmish (worth %.1f)", e.Target, e.Outcome.Value())
+				return Order{Type: ATTACK, Coords: bee.Pos, Direction: dir}, true
+			}
+			return Order{}, false
+		default:
+			return Order{}, false
+		}
+		return gm.retreat(bee, e)
+	}
+	return Order{}, false
+}
+
+// retreat steps the bee to the free hex furthest from the skirmish's enemies,
+// the one nearer home on ties
+func (gm *GameMap) retreat(bee *Bee, e Engagement) (Order, bool) {
+	danger := func(c Coords) int {
+		nearest := unreachable
+		for _, enemy := range e.Enemies {
+			nearest = min(nearest, dist(c, enemy))
+		}
+		return nearest
+	}
+	bestDir, bestAway, bestHome := Direction(""), danger(bee.Pos), 0
+	for _, dir := range dirs {
+		to := getCoords(bee.Pos, dir)
+		if gm.Mapped[to].Type != EMPTY_HEX || !gm.Reserved.free(bee.Pos, to, 1) {
+			continue
+		}
+		away := danger(to)
+		home := getDistanceToNearestHive(to, gm)
+		if away > bestAway || away == bestAway && bestDir != "" && home < bestHome {
+			bestDir, bestAway, bestHome = dir, away, home
+		}
+	}
+	if bestDir == "" {
+		return Order{}, false
+	}
+	gm.note(bee, "retreating from a losing skirmish (worth %.1f)", e.Outcome.Value())
+	to := getCoords(bee.Pos, bestDir)
+	gm.Reserved.reserve([]Coords{bee.Pos, to}, true)
+	return Order{Type: MOVE, Coords: bee.Pos, Direction: bestDir}, true
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+func TestHitsToKill(t *testing.T) {
+	tests := []struct{ hp, want int }{{0, 0}, {1, 1}, {arenaRules.BeeHp, arenaRules.BeeHp}, {arenaRules.HiveHp, arenaRules.HiveHp}}
+	for _, tt := range tests {
+		if got := hitsToKill(tt.hp); got != tt.want {
+			t.Errorf("hitsToKill(%d) = %d, want %d", tt.hp, got, tt.want)
+		}
+	}
+}
+
+func TestWeakestInReach(t *testing.T) {
+	at := Coords{Row: 0, Col: 0}
+	fighters := []Fighter{
+		{At: Coords{Row: 0, Col: 2}, Hp: 2},
+		{At: Coords{Row: 0, Col: 4}, Hp: 1},                // two away
+		{At: Coords{Row: 1, Col: 1}, Hp: 1},                // next to us
+		{At: Coords{Row: 1, Col: -1}, Hp: 1, Flower: true}, // as weak, carrying
+		{At: Coords{Row: 0, Col: -2}, Hp: 0},               // dead
+	}
+	tests := []struct {
+		name     string
+		fighters []Fighter
+		reach    int
+		want     int
+	}{
+		{"carrier first among the weakest", fighters, 1, 3},
+		{"further with more reach", fighters[:3], 2, 1},
+		{"nearest only", fighters[:3], 1, 2},
+		{"dead don't count", fighters[4:], 1, -1},
+		{"nobody in reach", fighters[1:2], 1, -1},
+	}
+	for _, tt := range tests {
+		if got := weakestInReach(tt.fighters, at, tt.reach); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fighter is a fighting bee at row, col with hp
+func fighter(row, col, hp int) Fighter {
+	return Fighter{At: Coords{Row: row, Col: col}, Hp: hp, Fights: true}
+}
+
+func TestSkirmishPlay(t *testing.T) {
+	carrier := fighter(0, 0, 2)
+	carrier.Flower, carrier.Fights = true, false
+	theirCarrier := fighter(0, 2, 1)
+	theirCarrier.Flower = true
+	tests := []struct {
+		name       string
+		s          Skirmish
+		oursFirst  bool
+		ourLosses  float64
+		theirLoses float64
+		flowers    float64 // lost by us, or denied to them when positive theirLoses
+	}{
+		{"1v1, us first", Skirmish{Ours: []Fighter{fighter(0, 0, 2)}, Theirs: []Fighter{fighter(0, 2, 2)}}, true, 0, 1, 0},
+		{"1v1, them first", Skirmish{Ours: []Fighter{fighter(0, 0, 2)}, Theirs: []Fighter{fighter(0, 2, 2)}}, false, 1, 0, 0},
+		{"1v1 against a hurt bee, them first", Skirmish{Ours: []Fighter{fighter(0, 0, 2)}, Theirs: []Fighter{fighter(0, 2, 1)}}, false, 0, 1, 0},
+		{"2v1, them first", Skirmish{Ours: []Fighter{fighter(0, 0, 2), fighter(1, 1, 2)}, Theirs: []Fighter{fighter(0, 2, 2)}}, false, 0, 1, 0},
+		{"1v2, us first", Skirmish{Ours: []Fighter{fighter(0, 2, 2)}, Theirs: []Fighter{fighter(0, 0, 2), fighter(1, 1, 2)}}, true, 1, 0, 0},
+		{"our carrier doesn't strike back", Skirmish{Ours: []Fighter{carrier}, Theirs: []Fighter{fighter(0, 2, 2)}}, true, 1, 0, 1},
+		{"their carrier drops its flower", Skirmish{Ours: []Fighter{fighter(0, 0, 2)}, Theirs: []Fighter{theirCarrier}}, false, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		o := tt.s.play(skirmishTurns, tt.oursFirst)
+		flowers := o.FlowersLost
+		if tt.theirLoses > 0 {
+			flowers = o.FlowersDenied
+		}
+		if o.OurLosses != tt.ourLosses || o.TheirLosses != tt.theirLoses || flowers != tt.flowers {
+			t.Errorf("%s: got %+v, want %v ours, %v theirs, %v flowers", tt.name, o, tt.ourLosses, tt.theirLoses, tt.flowers)
+		}
+	}
+}
+
+func TestSkirmishPredict(t *testing.T) {
+	spawn := float64(arenaRules.SpawnCost)
+	even := Skirmish{Ours: []Fighter{fighter(0, 0, 2)}, Theirs: []Fighter{fighter(0, 2, 2)}}
+	if o := even.Predict(skirmishTurns); o.OurLosses != 0.5 || o.TheirLosses != 0.5 || o.Value() != 0 {
+		t.Errorf("1v1: got %+v, want half a bee each", o)
+	}
+	twoOnOne := Skirmish{Ours: []Fighter{fighter(0, 0, 2), fighter(1, 1, 2)}, Theirs: []Fighter{fighter(0, 2, 2)}}
+	if v := twoOnOne.Predict(skirmishTurns).Value(); v != spawn {
+		t.Errorf("2v1: worth %v, want %v", v, spawn)
+	}
+	carrier := fighter(0, 0, 2)
+	carrier.Flower, carrier.Fights = true, false
+	caught := Skirmish{Ours: []Fighter{carrier}, Theirs: []Fighter{fighter(0, 2, 2)}}
+	if v := caught.Predict(skirmishTurns).Value(); v != -spawn-1 {
+		t.Errorf("caught carrier: worth %v, want %v", v, -spawn-1)
+	}
+}
+
+// engage plans the fight between our bees and theirs, all in the open, and
+// returns each of our bees' engagement by position (none if it has none)
+func engage(t *testing.T, ours, theirs map[Coords]*Entity) (*GameMap, map[Coords]Engagement) {
+	t.Helper()
+	state := &GameState{NumPlayers: 2, Hexes: map[Coords]*Hex{}}
+	myBees := map[Coords]*Hex{}
+	for c, e := range ours {
+		state.Hexes[c] = &Hex{Terrain: EMPTY, Entity: e}
+		myBees[c] = state.Hexes[c]
+	}
+	for c, e := range theirs {
+		state.Hexes[c] = &Hex{Terrain: EMPTY, Entity: e}
+	}
+	gm := &NewAgent(1, DefaultParams()).Map
+	gm.Tracker.Update(myBees, 1)
+	gm.planEngagements(state, 0)
+	plans := map[Coords]Engagement{}
+	for id, e := range gm.engagements {
+		plans[gm.Tracker.Bees[id].Pos] = e
+	}
+	return gm, plans
+}
+
+func TestPlanEngagements(t *testing.T) {
+	unit := func(player, hp int, flower bool) *Entity {
+		return &Entity{Type: BEE, Hp: hp, Player: player, HasFlower: flower}
+	}
+	a, b, c := Coords{Row: 0, Col: 0}, Coords{Row: 1, Col: 1}, Coords{Row: 0, Col: -2}
+	x, y := Coords{Row: 0, Col: 2}, Coords{Row: 1, Col: 3}
+
+	t.Run("focus fire on the weakest, no more bees than it takes", func(t *testing.T) {
+		_, plans := engage(t, map[Coords]*Entity{a: unit(0, 2, false), b: unit(0, 2, false)},
+			map[Coords]*Entity{x: unit(1, 1, false), y: unit(1, 2, false)})
+		if e := plans[a]; e.Kind != ENGAGE_ATTACK || e.Target != x {
+			t.Errorf("bee at %v: %+v, want to attack the hurt bee at %v", a, e, x)
+		}
+		if e := plans[b]; e.Kind != ENGAGE_ATTACK || e.Target != y {
+			t.Errorf("bee at %v: %+v, want to attack %v, %v needing one hit only", b, e, y, x)
+		}
+	})
+
+	t.Run("close in two hexes away", func(t *testing.T) {
+		_, plans := engage(t, map[Coords]*Entity{a: unit(0, 2, false), c: unit(0, 2, false)},
+			map[Coords]*Entity{x: unit(1, 2, false)})
+		if e := plans[a]; e.Kind != ENGAGE_ATTACK || e.Target != x {
+			t.Errorf("bee at %v: %+v, want to attack %v", a, e, x)
+		}
+		if e := plans[c]; e.Kind != ENGAGE_GANK || e.Target != x || !e.HasTarget {
+			t.Errorf("bee at %v: %+v, want to close in on %v", c, e, x)
+		}
+	})
+
+	t.Run("carriers keep walking", func(t *testing.T) {
+		_, plans := engage(t, map[Coords]*Entity{a: unit(0, 2, true)}, map[Coords]*Entity{x: unit(1, 2, false)})
+		if e, ok := plans[a]; ok {
+			t.Errorf("carrier at %v: %+v, want no engagement", a, e)
+		}
+	})
+
+	t.Run("retreat from a losing fight, holding against an enemy at 0,0", func(t *testing.T) {
+		gm, plans := engage(t, map[Coords]*Entity{x: unit(0, 2, false)},
+			map[Coords]*Entity{a: unit(1, 2, false), b: unit(1, 2, false)})
+		e := plans[x]
+		if e.Kind != ENGAGE_RETREAT || !e.HasTarget || e.Target != a {
+			t.Fatalf("bee at %v: %+v, want a retreat that keeps its target %v", x, e, a)
+		}
+		saboteur := gm.Tracker.At[x]
+		saboteur.Role = ROLE_SABOTEUR
+		order, ok := gm.engageOrder(saboteur)
+		if !ok || order.Type != ATTACK || order.Direction != W {
+			t.Errorf("saboteur: %v, %v, want to attack west, at %v", order, ok, a)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"container/heap"
+	"log/slog"
+)
+
+import . "hive-arena/common"
+
+/*
+Cooperative pathfinding (windowed hierarchical cooperative A*, WHCA*).
+Bees are planned one after the other, in priority order. Each plan is a
+search in space and time over the next Horizon turns that avoids the hexes
+and moves already reserved by earlier bees, and then reserves its own.
+Beyond the window a bee is guided by its true walking distance to the goal,
+ignoring other bees. Bees that have not been planned yet are assumed to stay put.
+*/
+
+const DefaultHorizon = 8
+
+// spaceTime is a hex t turns from now
+type spaceTime struct {
+	hex Coords
+	t   int
+}
+
+// moveTime is a bee stepping from -> to, arriving at turn t
+type moveTime struct {
+	from, to Coords
+	t        int
+}
+
+type Reservations struct {
+	Horizon int
+	cells   map[spaceTime]bool
+	swaps   map[moveTime]bool // moves that would swap places head-on with a reserved move
+	waiting map[Coords]bool   // bees not planned yet, they block their hex for the whole window
+	goals   map[goalKey]DistanceField
+
+	nodes []stNode
+	open  stOpenSet
+	seen  map[spaceTime]*stNode
+}
+
+type goalKey struct {
+	target     Coords
+	stopNextTo bool
+	walls      bool
+}
+
+type stNode struct {
+	at        spaceTime
+	cost      int
+	total     int
+	prev      *stNode
+	index     int
+	closed    bool
+	reachGoal bool
+}
+
+type stOpenSet []*stNode
+
+func (o stOpenSet) Len() int { return len(o) }
+func (o stOpenSet) Less(i, j int) bool {
+	if o[i].total == o[j].total {
+		return o[i].at.t > o[j].at.t
+	}
+	return o[i].total < o[j].total
+}
+func (o stOpenSet) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+	o[i].index = i
+	o[j].index = j
+}
+func (o *stOpenSet) Push(x any) {
+	n := x.(*stNode)
+	n.index = len(*o)
+	*o = append(*o, n)
+}
+func (o *stOpenSet) Pop() any {
+	old := *o
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*o = old[:len(old)-1]
+	return n
+}
+
+func NewReservations(horizon int) *Reservations {
+	return &Reservations{
+		Horizon: horizon,
+		cells:   make(map[spaceTime]bool),
+		swaps:   make(map[moveTime]bool),
+		waiting: make(map[Coords]bool),
+		goals:   make(map[goalKey]DistanceField),
+		seen:    make(map[spaceTime]*stNode),
+	}
+}
+
+// Reset starts a new turn with all our bees standing where they are
+func (r *Reservations) Reset(bees map[Coords]*Hex) {
+	clear(r.cells)
+	clear(r.swaps)
+	clear(r.waiting)
+	clear(r.goals)
+	for bee := range bees {
+		r.waiting[bee] = true
+	}
+}
+
+// Hold keeps hex occupied for the whole window, for a bee that isn't moving
+func (r *Reservations) Hold(hex Coords) {
+	delete(r.waiting, hex)
+	for t := 1; t <= r.Horizon; t++ {
+		r.cells[spaceTime{hex, t}] = true
+	}
+}
+
+func (r *Reservations) free(from, to Coords, t int) bool {
+	return !r.cells[spaceTime{to, t}] && !r.waiting[to] && !r.swaps[moveTime{from, to, t}]
+}
+
+// reserve claims steps[t] at turn t, and the rest of the window at the end if the bee got there
+func (r *Reservations) reserve(steps []Coords, arrived bool) {
+	delete(r.waiting, steps[0])
+	for t := 1; t < len(steps); t++ {
+		r.cells[spaceTime{steps[t], t}] = true
+		r.swaps[moveTime{steps[t], steps[t-1], t}] = true
+	}
+	if arrived {
+		last := steps[len(steps)-1]
+		for t := len(steps); t <= r.Horizon; t++ {
+			r.cells[spaceTime{last, t}] = true
+		}
+	}
+}
+
+// walkable for planning: our own bees move out of the way, enemies and terrain don't
+func coopWalkable(tile GameMapObject) bool {
+	switch tile.Type {
+	case EMPTY_HEX, ENEMY_WALL, OWN_BEE, EXPLORER:
+		return true
+	}
+	return false
+}
+
+// enterCost is the moves it takes to step onto tile, breaking it first if it's a wall
+func (gm *GameMap) enterCost(tile GameMapObject) int {
+	if tile.Type == ENEMY_WALL {
+		return 1 + gm.params.WallCost
+	}
+	return 1
+}
+
+// goalDistances is the walking distance from every hex to the goal, ignoring
+// our bees and the cost's extras. It is the A* heuristic, shared by all bees
+// heading to the same place this turn.
+func (gm *GameMap) goalDistances(target Coords, stopNextTo bool, cost PathCost) DistanceField {
+	key := goalKey{target, stopNextTo, cost.Walls}
+	if d, ok := gm.Reserved.goals[key]; ok {
+		return d
+	}
+	d := gm.buildField([]Coords{target}, stopNextTo, cost.walkable)
+	gm.Reserved.goals[key] = d
+	return d
+}
+
+func (r *Reservations) newNode(at spaceTime, cost, h int, prev *stNode) *stNode {
+	r.nodes = append(r.nodes, stNode{
+		at:        at,
+		cost:      cost,
+		total:     cost + h,
+		prev:      prev,
+		reachGoal: h == 0,
+	})
+	n := &r.nodes[len(r.nodes)-1]
+	r.seen[at] = n
+	return n
+}
+
+// planPath searches space and time from loc and reserves the result.
+// Waiting pays the cost's extras too, so a bee doesn't sit in danger.
+// The returned steps start at loc; steps[1] == loc means wait this turn.
+func (gm *GameMap) planPath(loc, target Coords, stopNextTo bool, cost PathCost) ([]Coords, bool) {
+	r := gm.Reserved
+	delete(r.waiting, loc) //being planned now, it no longer blocks itself
+	h := gm.goalDistances(target, stopNextTo, cost)
+	if _, ok := h[loc]; !ok {
+		return nil, false
+	}
+	limit := (len(gm.Mapped) + 1) * (r.Horizon + 1)
+	if cap(r.nodes) < limit {
+		r.nodes = make([]stNode, 0, limit) //pointers into nodes must stay valid
+	}
+	r.nodes = r.nodes[:0]
+	r.open = r.open[:0]
+	clear(r.seen)
+
+	heap.Push(&r.open, r.newNode(spaceTime{loc, 0}, 0, h[loc].Dist, nil))
+	for r.open.Len() > 0 {
+		current := heap.Pop(&r.open).(*stNode)
+		current.closed = true
+		if current.reachGoal || current.at.t == r.Horizon {
+			var steps []Coords
+			for n := current; n != nil; n = n.prev {
+				steps = append(steps, n.at.hex)
+			}
+			for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+				steps[i], steps[j] = steps[j], steps[i]
+			}
+			r.reserve(steps, current.reachGoal)
+			return steps, true
+		}
+
+		t := current.at.t + 1
+		wait := spaceTime{current.at.hex, t}
+		moves := [7]spaceTime{wait}
+		for i, dir := range dirs {
+			moves[i+1] = spaceTime{getCoords(current.at.hex, dir), t}
+		}
+		for _, next := range moves {
+			remaining, known := h[next.hex]
+			if !known {
+				continue
+			}
+			if next != wait && !r.free(current.at.hex, next.hex, t) {
+				continue
+			}
+			if next == wait && r.cells[next] {
+				continue
+			}
+			step := current.cost + 1
+			if next != wait {
+				step = current.cost + gm.enterCost(gm.Mapped[next.hex])
+			}
+			step += cost.extra(gm, loc, next.hex)
+			cand, exists := r.seen[next]
+			if !exists {
+				heap.Push(&r.open, r.newNode(next, step, remaining.Dist, current))
+				continue
+			}
+			if cand.closed || step >= cand.cost {
+				continue
+			}
+			cand.prev = current
+			cand.total += step - cand.cost
+			cand.cost = step
+			heap.Fix(&r.open, cand.index)
+		}
+	}
+	return nil, false
+}
+
+// planStep plans a bee's way to target at cost and returns this turn's order.
+// An empty order with ok set means the bee should wait for others to pass.
+func (gm *GameMap) planStep(loc, target Coords, stopNextTo bool, cost PathCost) (Order, bool) {
+	steps, ok := gm.planPath(loc, target, stopNextTo, cost)
+	if bee := gm.Tracker.At[loc]; bee != nil {
+		bee.Path = steps
+	}
+	if !ok {
+		gm.trace.Of(SUB_PATH).Debug("no path", beeAttr(gm.Tracker.At[loc]), "to", target)
+		gm.Reserved.Hold(loc)
+		return Order{}, false
+	}
+	if len(steps) < 2 || steps[1] == loc {
+		gm.trace.Of(SUB_PATH).Debug("waiting", beeAttr(gm.Tracker.At[loc]), "to", target, "planned", len(steps)-1)
+		return Order{}, true
+	}
+	if gm.trace.Enabled(SUB_PATH, slog.LevelDebug) {
+		gm.trace.Of(SUB_PATH).Debug("planned", beeAttr(gm.Tracker.At[loc]), "to", target, "steps", len(steps)-1, "cost", cost.Name)
+	}
+	order := goTo(loc, steps[1], gm)
+	if order.Type == ATTACK { //breaking a wall, we stay where we are
+		gm.Reserved.Hold(loc)
+	}
+	return order, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// planAll plans every bee, in order, from its start to its goal on gm and
+// returns the plans
+func planAll(t *testing.T, gm *GameMap, starts, goals []Coords) [][]Coords {
+	t.Helper()
+	clear(gm.MyBees)
+	for _, c := range starts {
+		gm.MyBees[c] = &Hex{}
+	}
+	gm.Reserved.Reset(gm.MyBees)
+	plans := make([][]Coords, len(starts))
+	for i := range starts {
+		steps, ok := gm.planPath(starts[i], goals[i], false, UniformCost)
+		if !ok {
+			t.Fatalf("bee %d at %v: no plan to %v", i, starts[i], goals[i])
+		}
+		plans[i] = steps
+	}
+	return plans
+}
+
+// collisions finds two bees on the same hex, or passing through each other,
+// at some turn of their plans. A bee stays where its plan ends.
+func collisions(plans [][]Coords) []string {
+	at := func(plan []Coords, t int) Coords { return plan[min(t, len(plan)-1)] }
+	var found []string
+	for t := 1; t <= DefaultHorizon; t++ {
+		for i := range plans {
+			for j := i + 1; j < len(plans); j++ {
+				a, b := plans[i], plans[j]
+				switch {
+				case at(a, t) == at(b, t):
+					found = append(found, "same hex")
+				case at(a, t) == at(b, t-1) && at(b, t) == at(a, t-1):
+					found = append(found, "swapped")
+				}
+			}
+		}
+	}
+	return found
+}
+
+// TestPlanPathPassing has two bees swap ends of a strip two hexes wide,
+// replanning every turn like the agent does: they pass without colliding
+func TestPlanPathPassing(t *testing.T) {
+	left, right := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 8}
+	gm := openMap(2, 5)
+	bees, goals := []Coords{left, right}, []Coords{right, left}
+	for turn := 0; turn < 12 && (bees[0] != goals[0] || bees[1] != goals[1]); turn++ {
+		plans := planAll(t, &gm, bees, goals)
+		if c := collisions(plans); len(c) > 0 {
+			t.Fatalf("turn %d: plans %v collide: %v", turn, plans, c)
+		}
+		for i, plan := range plans {
+			if len(plan) > 1 {
+				bees[i] = plan[1]
+			}
+		}
+	}
+	if bees[0] != goals[0] || bees[1] != goals[1] {
+		t.Errorf("bees at %v after 12 turns, want %v", bees, goals)
+	}
+}
+
+// TestPlanPathCorridor sends two bees down a corridor one hex wide, the one
+// behind planned first: it follows instead of running into the other
+func TestPlanPathCorridor(t *testing.T) {
+	gm := openMap(1, 8)
+	behind, ahead := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 2}
+	plans := planAll(t, &gm, []Coords{behind, ahead}, []Coords{{Row: 0, Col: 10}, {Row: 0, Col: 12}})
+	if c := collisions(plans); len(c) > 0 {
+		t.Errorf("plans %v collide: %v", plans, c)
+	}
+	if len(plans[0]) < 2 || plans[0][1] != behind {
+		t.Errorf("bee behind: %v, want it to wait for the one ahead to move", plans[0])
+	}
+	if len(plans[1]) != 6 {
+		t.Errorf("bee ahead: %v, want it to walk straight there", plans[1])
+	}
+}
+
+// TestPlanPathBlockedCorridor plans a bee down a corridor while another one,
+// not planned yet, sits in it: that bee blocks the way for the whole window
+func TestPlanPathBlockedCorridor(t *testing.T) {
+	gm := openMap(1, 6)
+	waiting := Coords{Row: 0, Col: 4}
+	plans := planAll(t, &gm, []Coords{{Row: 0, Col: 0}, waiting}, []Coords{{Row: 0, Col: 10}, waiting})
+	for _, c := range plans[0] {
+		if c.Col >= waiting.Col {
+			t.Fatalf("plan %v goes through the waiting bee", plans[0])
+		}
+	}
+}
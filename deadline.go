@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+import . "hive-arena/common"
+
+// Strategy decides a turn. It should Add orders to out as soon as each one is
+// ready and return early once ctx is done; whatever was added by then is sent.
+type Strategy func(ctx context.Context, state *GameState, player int, out *OrderSet)
+
+// OrderSet collects a turn's orders incrementally. Once the client has
+// taken the orders with Close, anything added later is dropped.
+type OrderSet struct {
+	mu     sync.Mutex
+	orders []Order
+	closed bool
+	sent   []Order // what went to the server: the orders Close took, then the deadline's fallback
+}
+
+func (s *OrderSet) Add(o Order) {
+	if o.Type == "" { //empty order means "nothing to do"
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.orders = append(s.orders, o)
+	}
+}
+
+func (s *OrderSet) Close() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.sent = slices.Clip(s.orders)
+	return s.orders
+}
+
+// fill adds the deadline's fallback orders to what was sent
+func (s *OrderSet) fill(extra []Order) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, extra...)
+}
+
+// Sent is what went to the server for the turn, once it is closed
+func (s *OrderSet) Sent() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+// turnRunner runs the strategy for each turn under a time budget
+type turnRunner struct {
+	strategy     Strategy
+	deadline     time.Duration
+	busy         chan struct{}        // closed when the last strategy call has returned
+	lastThink    time.Duration        // how long the last strategy call had before its orders went
+	lastCut      bool                 // the deadline or a panic cut the last turn's think short
+	lastFallback int                  // orders the deadline had to fill in last turn
+	lastMoves    map[Coords]Direction // where each bee should be now -> the way it was going
+	trace        *Tracer
+}
+
+func newTurnRunner(strategy Strategy, deadline time.Duration, trace *Tracer) *turnRunner {
+	return &turnRunner{
+		strategy:  strategy,
+		deadline:  deadline,
+		lastMoves: make(map[Coords]Direction),
+		trace:     trace,
+	}
+}
+
+// play thinks about the turn within the deadline and returns the orders to
+// send. A think cut short by the deadline, or by a panic, has the rest of the
+// bees filled in by fallbackOrders. If the last turn's think is still running
+// when the deadline comes, the turn gets only fallback orders: strategies keep
+// state between turns, two never run at once.
+func (t *turnRunner) play(state *GameState, player int) []Order {
+	t.trace.Turn = state.Turn
+	log := t.trace.Of(SUB_TURN)
+	start := time.Now()
+	ctx := context.Background()
+	if t.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.deadline)
+		defer cancel()
+	}
+
+	if t.busy != nil {
+		select {
+		case <-t.busy:
+		default:
+			log.Warn("previous think still running, waiting for it")
+			select {
+			case <-t.busy:
+			case <-ctx.Done():
+				log.Warn("previous think still running at the deadline, sending fallback orders only")
+				out := &OrderSet{}
+				out.Close()
+				return t.finish(state, player, out, start, true)
+			}
+		}
+	}
+
+	out := &OrderSet{}
+	done := make(chan struct{})
+	panicked := false //only read once done is closed
+	t.busy = done
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("think panicked", "panic", r)
+				panicked = true
+			}
+		}()
+		t.strategy(ctx, state, player, out)
+	}()
+
+	cut := false
+	select {
+	case <-done:
+		cut = panicked
+	case <-ctx.Done():
+		select { //it may have finished at the same instant
+		case <-done:
+			cut = panicked
+		default:
+			cut = true
+		}
+	}
+	out.Close()
+	return t.finish(state, player, out, start, cut)
+}
+
+// finish fills in fallback orders on a cut turn, notes how the turn went and
+// returns the orders to send
+func (t *turnRunner) finish(state *GameState, player int, out *OrderSet, start time.Time, cut bool) []Order {
+	elapsed := time.Since(start)
+	t.lastThink = elapsed
+	fallback := 0
+	if cut {
+		extra := fallbackOrders(state, player, out.Sent(), t.lastMoves)
+		fallback = len(extra)
+		out.fill(extra)
+	}
+	orders := out.Sent()
+	t.lastCut, t.lastFallback = cut, fallback
+	if t.deadline > 0 {
+		t.trace.Of(SUB_TURN).Info("think", "took", elapsed.Round(time.Millisecond), "of", t.deadline, "share", int(100*elapsed/t.deadline),
+			"orders", len(orders), "fallback", fallback, "cut", cut)
+	}
+
+	clear(t.lastMoves)
+	for _, o := range orders {
+		if o.Type == MOVE {
+			t.lastMoves[getCoords(o.Coords, o.Direction)] = o.Direction
+		}
+	}
+	return orders
+}
+
+// fallbackOrders gives every bee the strategy did not get to a cheap order:
+// forage if that makes sense where it stands, otherwise keep going the way it went last turn.
+func fallbackOrders(state *GameState, player int, ordered []Order, lastMoves map[Coords]Direction) []Order {
+	hasOrder := make(map[Coords]bool)
+	for _, o := range ordered {
+		hasOrder[o.Coords] = true
+	}
+	var orders []Order
+	for _, coords := range sortedKeys(state.Hexes) {
+		hex := state.Hexes[coords]
+		unit := hex.Entity
+		if unit == nil || unit.Type != BEE || unit.Player != player || hasOrder[coords] {
+			continue
+		}
+		if !unit.HasFlower && hex.Resources > 0 {
+			orders = append(orders, Order{Type: FORAGE, Coords: coords})
+			continue
+		}
+		if unit.HasFlower && nextToOwnHive(state, coords, player) {
+			orders = append(orders, Order{Type: FORAGE, Coords: coords})
+			continue
+		}
+		if dir, ok := lastMoves[coords]; ok {
+			next, visible := state.Hexes[getCoords(coords, dir)]
+			if visible && next.Terrain.IsWalkable() && next.Entity == nil {
+				orders = append(orders, Order{Type: MOVE, Coords: coords, Direction: dir})
+			}
+		}
+	}
+	return orders
+}
+
+func nextToOwnHive(state *GameState, coords Coords, player int) bool {
+	for _, dir := range dirs {
+		hex, ok := state.Hexes[getCoords(coords, dir)]
+		if ok && hex.Entity != nil && hex.Entity.Type == HIVE && hex.Entity.Player == player {
+			return true
+		}
+	}
+	return false
+}
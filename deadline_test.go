@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import . "hive-arena/common"
+
+// TestPanicGetsFallback has think add nothing and panic: the bee still gets
+// the fallback order, and the set think wrote to says so
+func TestPanicGetsFallback(t *testing.T) {
+	var seen *OrderSet
+	runner := newTurnRunner(func(ctx context.Context, state *GameState, player int, out *OrderSet) {
+		seen = out
+		panic("bad think")
+	}, time.Second, NoTrace())
+	state := scriptedStates(1)[0]
+	orders := runner.play(&state, 0)
+	if len(orders) != 1 || orders[0].Type != FORAGE || runner.lastFallback != 1 {
+		t.Fatalf("orders %v, %d fallback, want one fallback FORAGE", orders, runner.lastFallback)
+	}
+	if sent := seen.Sent(); len(sent) != 1 || sent[0] != orders[0] {
+		t.Errorf("Sent is %v, want the fallback order", sent)
+	}
+}
+
+// TestStuckThinkIsNotWaitedFor has the first think run past the next turn's
+// deadline: that turn is played on fallback orders alone, within its
+// deadline, and think is not started a second time while the first runs
+func TestStuckThinkIsNotWaitedFor(t *testing.T) {
+	const deadline = 50 * time.Millisecond
+	release := make(chan struct{})
+	var calls atomic.Int32
+	runner := newTurnRunner(func(ctx context.Context, state *GameState, player int, out *OrderSet) {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+	}, deadline, NoTrace())
+	states := scriptedStates(3)
+
+	runner.play(&states[0], 0)
+	start := time.Now()
+	orders := runner.play(&states[1], 0)
+	if took := time.Since(start); took > 4*deadline {
+		t.Errorf("turn 2 took %v with a %v deadline", took, deadline)
+	}
+	if len(orders) != 1 || runner.lastFallback != 1 {
+		t.Errorf("turn 2: orders %v, %d fallback, want the fallback order", orders, runner.lastFallback)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("think started %d times while the first was running", n)
+	}
+
+	close(release)
+	runner.play(&states[2], 0)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("think ran %d times, want 2 once the first returned", n)
+	}
+}
+
+// TestTrackerFollowsSentOrders cuts a turn before think adds anything and
+// sends an order of the runner's instead: the tracker goes by that order
+func TestTrackerFollowsSentOrders(t *testing.T) {
+	a := NewAgent(1, DefaultParams())
+	states := scriptedStates(2)
+	bee := Coords{Row: 0, Col: 0}
+	target := getCoords(bee, SE)
+
+	out := &OrderSet{}
+	out.Close() //cut before think got going: everything it adds is dropped
+	a.Think(context.Background(), &states[0], 0, out)
+	out.fill([]Order{{Type: ATTACK, Coords: bee, Direction: SE}})
+	if len(out.Sent()) != 1 {
+		t.Fatalf("sent %v, want only the filled in order", out.Sent())
+	}
+
+	a.Think(context.Background(), &states[1], 0, &OrderSet{})
+	if hits := a.Map.Tracker.Attacked; len(hits) != 1 || hits[target] != 1 {
+		t.Errorf("tracker saw attacks %v, want one on %v", hits, target)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+import . "hive-arena/common"
+
+/*
+The debugger steps through a replay log with a new agent (same seed), showing
+the agent's own map after each turn's think. Going back replays from the first
+turn, the agent's memory only runs forwards. Selecting a bee shows its role,
+task, the path it planned this turn and why it got its order.
+*/
+
+const debugHelp = `n / enter   next turn          p   previous turn
+g <turn>    go to turn         b <id>      select bee by ID
+c <row,col> select bee at hex  l   list bees
+q           quit`
+
+type debugger struct {
+	header   ReplayHeader
+	turns    []ReplayTurn
+	agent    *Agent
+	at       int     // index in turns the agent has just thought about, -1 before the first
+	orders   []Order // the agent's orders for turns[at]
+	selected int     // bee ID, 0 for none
+	message  string
+}
+
+func newDebugger(header ReplayHeader, turns []ReplayTurn) *debugger {
+	d := &debugger{header: header, turns: turns, at: -1}
+	d.restart()
+	return d
+}
+
+// restart sets up a new agent that keeps the reasons for its orders
+func (d *debugger) restart() {
+	d.agent = d.header.agent()
+	d.agent.Map.explaining = true
+	d.at = -1
+}
+
+// seek makes the agent think its way to turns[i]
+func (d *debugger) seek(i int) {
+	i = max(0, min(i, len(d.turns)-1))
+	if i < d.at {
+		d.restart()
+	}
+	for d.at < i {
+		d.at++
+		t := d.turns[d.at]
+		out := &OrderSet{}
+		d.agent.Think(context.Background(), t.State, t.Player, out)
+		d.orders = out.Close()
+	}
+}
+
+func (d *debugger) bee() *Bee {
+	return d.agent.Map.Tracker.Bees[d.selected]
+}
+
+// render draws the map with the selected bee as @, the path it planned as * and its goal as T
+func (d *debugger) render(w io.Writer) {
+	gm := &d.agent.Map
+	t := d.turns[d.at]
+	overlay := make(map[Coords]string)
+	if bee := d.bee(); bee != nil {
+		for _, c := range bee.Path {
+			overlay[c] = "* "
+		}
+		if bee.Goal != bee.Pos {
+			overlay[bee.Goal] = "T "
+		}
+		overlay[bee.Pos] = "@ "
+	}
+
+	fmt.Fprint(w, "\033[2J\033[H")
+	minR, maxR, minC, maxC := gm.mapBounds()
+	for r := minR; r <= maxR; r++ {
+		for c := minC; c <= maxC; c++ {
+			at := Coords{Row: r, Col: c}
+			if s, ok := overlay[at]; ok {
+				fmt.Fprint(w, s)
+			} else {
+				fmt.Fprint(w, gm.symbolAt(at))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "\ngame %s  turn %d (%d/%d)  player %d  resources %v  bees %d  orders %d (recorded %d)\n",
+		d.header.Game, t.Turn, d.at+1, len(d.turns), t.Player, t.State.PlayerResources,
+		len(gm.Tracker.Bees), len(d.orders), len(t.Orders))
+	if bee := d.bee(); bee != nil {
+		fmt.Fprintf(w, "bee %d at %v: %s, goal %v, task %v, target %v, flower %v, born turn %d\n",
+			bee.ID, bee.Pos, bee.Role, bee.Goal, bee.Task, bee.Target, bee.HasFlower, bee.Born)
+		fmt.Fprintf(w, "  why: %s\n", bee.Reason)
+		fmt.Fprintf(w, "  order: %s\n", d.orderOf(bee.Pos))
+		if len(bee.Path) > 1 {
+			fmt.Fprintf(w, "  planned: %d steps over the next turns\n", len(bee.Path)-1)
+		}
+	} else if d.selected != 0 {
+		fmt.Fprintf(w, "bee %d is not alive this turn\n", d.selected)
+	}
+	if d.message != "" {
+		fmt.Fprintln(w, d.message)
+		d.message = ""
+	}
+	fmt.Fprint(w, "> ")
+}
+
+func (d *debugger) orderOf(c Coords) string {
+	for _, o := range d.orders {
+		if o.Coords == c {
+			return fmt.Sprintf("%s %s", o.Type, o.Direction)
+		}
+	}
+	return "none"
+}
+
+// command runs one line of input, false to quit
+func (d *debugger) command(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		d.seek(d.at + 1)
+		return true
+	}
+	arg := ""
+	if len(fields) > 1 {
+		arg = fields[1]
+	}
+	switch fields[0] {
+	case "n":
+		d.seek(d.at + 1)
+	case "p":
+		d.seek(d.at - 1)
+	case "g":
+		turn, err := strconv.Atoi(arg)
+		if err != nil {
+			d.message = "g wants a turn number"
+			break
+		}
+		for i, t := range d.turns {
+			if int(t.Turn) >= turn {
+				d.seek(i)
+				break
+			}
+		}
+	case "b":
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			d.message = "b wants a bee ID"
+			break
+		}
+		d.selected = id
+	case "c":
+		var c Coords
+		if _, err := fmt.Sscanf(arg, "%d,%d", &c.Row, &c.Col); err != nil {
+			d.message = "c wants row,col"
+			break
+		}
+		if bee := d.agent.Map.Tracker.At[c]; bee != nil {
+			d.selected = bee.ID
+		} else {
+			d.message = fmt.Sprintf("no bee of ours at %v", c)
+		}
+	case "l":
+		var b strings.Builder
+		for _, bee := range d.agent.Map.Tracker.sorted() {
+			fmt.Fprintf(&b, "%3d %v %-8s %s\n", bee.ID, bee.Pos, bee.Role, bee.Reason)
+		}
+		d.message = b.String()
+	case "q":
+		return false
+	default:
+		d.message = debugHelp
+	}
+	return true
+}
+
+// runDebugger steps through a replay log interactively, starting at turn start.
+// Run with `go run . [-turn n] debug <log>`.
+func runDebugger(path string, start uint) error {
+	header, turns, err := ReadReplay(path)
+	if len(turns) == 0 {
+		if err == nil {
+			err = fmt.Errorf("%s has no turns", path)
+		}
+		return err
+	}
+	d := newDebugger(header, turns)
+	d.message = debugHelp
+	d.command(fmt.Sprintf("g %d", start))
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		d.render(os.Stdout)
+		if !in.Scan() || !d.command(in.Text()) {
+			return in.Err()
+		}
+	}
+}
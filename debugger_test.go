@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+// TestDebuggerShowsPlannedPath steps the debugger through a simulated game:
+// the bees it shows carry the path they planned and the reason for their order,
+// while the agent that played the game kept no reasons
+func TestDebuggerShowsPlannedPath(t *testing.T) {
+	const seed = 11
+	rules := sim.DefaultRules()
+	rules.MaxTurns = 30
+	g := sim.NewGame(sim.Generate(sim.Presets["tiny"], 2, rules, seed), 2, rules, seed)
+	header := ReplayHeader{Game: "test", Seed: seed}
+	played := header.agent()
+	var turns []ReplayTurn
+	players := make([]sim.Player, 2)
+	for p := range players {
+		players[p] = simPlayer(seed+int64(p), DefaultParams(), NoTrace())
+	}
+	players[0] = func(state *GameState, player int) []Order {
+		turns = append(turns, ReplayTurn{Turn: state.Turn, Player: player, State: state})
+		out := &OrderSet{}
+		played.Think(t.Context(), state, player, out)
+		return out.Close()
+	}
+	sim.Play(g, players)
+
+	for _, bee := range played.Map.Tracker.Bees {
+		if bee.Reason != "" {
+			t.Fatalf("bee %d kept a reason without the debugger or tracing: %q", bee.ID, bee.Reason)
+		}
+	}
+
+	d := newDebugger(header, turns)
+	d.seek(len(turns) - 1)
+	planned := 0
+	for id, bee := range d.agent.Map.Tracker.Bees {
+		if bee.Reason == "" {
+			t.Errorf("bee %d at %v has no reason", id, bee.Pos)
+		}
+		if len(bee.Path) == 0 {
+			continue
+		}
+		planned++
+		if bee.Path[0] != bee.Pos {
+			t.Errorf("bee %d at %v: planned path starts at %v", id, bee.Pos, bee.Path[0])
+		}
+		d.selected = id
+		var out strings.Builder
+		d.render(&out)
+		if !strings.Contains(out.String(), "planned:") && len(bee.Path) > 1 {
+			t.Errorf("bee %d: render does not show its planned path:\n%s", id, out.String())
+		}
+	}
+	if planned == 0 {
+		t.Fatal("no bee planned a path")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+Hive defense: every turn the enemy bees we can see near our hives are
+weighed as threats, by how short their walk to one of our hives is. Bees
+already parked next to a hive weigh the most, passing flower carriers the
+least. Defenders are recruited for the threats that weigh enough and each
+goes for its own one. Separately, a hive with every face taken can't spawn,
+so one of our idle bees next to it steps away.
+*/
+
+// Threat is an enemy bee near one of our hives
+type Threat struct {
+	Enemy  Coords
+	Hive   Coords  // the hive it is closest to
+	Dist   int     // its walk to stand next to that hive, 0 when it already does
+	Danger float64 // 1 when next to the hive, down to near 0 at DefenseRadius
+}
+
+// findThreats weighs the enemy bees in sight, most dangerous first
+func (gm *GameMap) findThreats(state *GameState, player int) []Threat {
+	radius := gm.params.DefenseRadius
+	var threats []Threat
+	for _, c := range sortedKeys(state.Hexes) {
+		unit := state.Hexes[c].Entity
+		if unit == nil || unit.Type != BEE || unit.Player == player {
+			continue
+		}
+		hive, d, ok := gm.NearestHive(c)
+		if !ok || d > radius {
+			continue
+		}
+		danger := float64(radius+1-d) / float64(radius+1)
+		if unit.HasFlower {
+			danger /= 2 //on its way home, most likely
+		}
+		threats = append(threats, Threat{Enemy: c, Hive: hive, Dist: d, Danger: danger})
+	}
+	slices.SortStableFunc(threats, func(a, b Threat) int {
+		if a.Danger != b.Danger {
+			if a.Danger > b.Danger {
+				return -1
+			}
+			return 1
+		}
+		return compareCoords(a.Enemy, b.Enemy)
+	})
+	return threats
+}
+
+// seriousThreats are the threats worth sending a defender for
+func (gm *GameMap) seriousThreats() []Threat {
+	var serious []Threat
+	for _, t := range gm.Threats {
+		if t.Danger >= gm.params.DefendThreat {
+			serious = append(serious, t)
+		}
+	}
+	return serious
+}
+
+// claimThreat gives the defender the most dangerous unclaimed serious threat,
+// the nearest one on ties, or the nearest claimed one when all are taken
+func (gm *GameMap) claimThreat(bee *Bee) (Threat, bool) {
+	serious := gm.seriousThreats()
+	var best Threat
+	found := false
+	for _, claimedToo := range []bool{false, true} {
+		for _, t := range serious {
+			if gm.threatClaims[t.Enemy] && !claimedToo {
+				continue
+			}
+			if !found || t.Danger > best.Danger || t.Danger == best.Danger && dist(bee.Pos, t.Enemy) < dist(bee.Pos, best.Enemy) {
+				best, found = t, true
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if found {
+		gm.threatClaims[best.Enemy] = true
+	}
+	return best, found
+}
+
+// freeFace tells if a hive has a face a bee could be spawned onto
+func (gm *GameMap) freeFace(hive Coords) bool {
+	for _, dir := range dirs {
+		if gm.Mapped[getCoords(hive, dir)].Type == EMPTY_HEX {
+			return true
+		}
+	}
+	return false
+}
+
+// planSpawnFaces picks, for every hive with no free face, one of our bees next
+// to it without a flower to step away
+func (gm *GameMap) planSpawnFaces() {
+	clear(gm.faceClearers)
+	for _, hive := range sortedKeys(gm.MyHives) {
+		if gm.freeFace(hive) {
+			continue
+		}
+		var chosen *Bee
+		for _, dir := range dirs {
+			bee := gm.Tracker.At[getCoords(hive, dir)]
+			if bee == nil || bee.HasFlower || bee.Role == ROLE_SABOTEUR {
+				continue
+			}
+			if _, taken := gm.faceClearers[bee.ID]; !taken && (chosen == nil || bee.ID < chosen.ID) {
+				chosen = bee
+			}
+		}
+		if chosen != nil {
+			gm.faceClearers[chosen.ID] = hive
+			gm.trace.Of(SUB_DEFEND).Info("hive has no free face, making room", "hive", hive, beeAttr(chosen))
+		} else {
+			gm.trace.Of(SUB_DEFEND).Warn("hive has no free face and none of ours to move", "hive", hive)
+		}
+	}
+}
+
+// clearFace steps a bee away from hive, onto a hex that isn't next to it
+func (gm *GameMap) clearFace(bee *Bee, hive Coords) (Order, bool) {
+	for _, dir := range dirs {
+		to := getCoords(bee.Pos, dir)
+		if gm.Mapped[to].Type != EMPTY_HEX || dist(to, hive) <= 1 || !gm.Reserved.free(bee.Pos, to, 1) {
+			continue
+		}
+		gm.note(bee, "stepping away from hive %v so it can spawn", hive)
+		gm.Reserved.reserve([]Coords{bee.Pos, to}, true)
+		return Order{Type: MOVE, Coords: bee.Pos, Direction: dir}, true
+	}
+	return Order{}, false
+}
+
+// orderFor is the bee's order from its role, unless it has to make room at a
+// hive or has a part in a skirmish (combat.go) first
+func (a *Agent) orderFor(bee *Bee, w *World) Order {
+	if hive, ok := a.Map.faceClearers[bee.ID]; ok {
+		if o, ok := a.Map.clearFace(bee, hive); ok {
+			return o
+		}
+	}
+	if o, ok := a.Map.engageOrder(bee); ok {
+		return o
+	}
+	return a.roles.Of(bee).Order(bee, w)
+}
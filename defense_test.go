@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// defenseMap is the map of player 0 in enemyStates' world, hive at 0,0, with bees
+func defenseMap(bees map[Coords]*Entity) (*GameMap, *GameState) {
+	state := enemyStates([]map[Coords]*Entity{bees}, [][]uint{{6, 6}})[0]
+	gm := &NewAgent(1, DefaultParams()).Map
+	gm.updateGameMap(state, 0)
+	return gm, state
+}
+
+func TestFindThreats(t *testing.T) {
+	enemy := func(flower bool) *Entity { return &Entity{Type: BEE, Hp: 2, Player: 1, HasFlower: flower} }
+	next, step, carrier, tied, far := Coords{Row: 0, Col: 2}, Coords{Row: 0, Col: 4}, Coords{Row: 1, Col: 3}, Coords{Row: 2, Col: 2}, Coords{Row: 6, Col: 8}
+	gm, state := defenseMap(map[Coords]*Entity{
+		next: enemy(false), step: enemy(false), carrier: enemy(true), tied: enemy(false), far: enemy(false),
+		{Row: 1, Col: -1}: {Type: BEE, Hp: 2, Player: 0},
+	})
+
+	threats := gm.findThreats(state, 0)
+	radius := float64(gm.params.DefenseRadius + 1)
+	want := []Threat{
+		{Enemy: next, Dist: 0, Danger: 1},
+		{Enemy: step, Dist: 1, Danger: (radius - 1) / radius},
+		{Enemy: tied, Dist: 1, Danger: (radius - 1) / radius},
+		{Enemy: carrier, Dist: 1, Danger: (radius - 1) / radius / 2},
+	}
+	if len(threats) != len(want) {
+		t.Fatalf("threats %+v, want %+v", threats, want)
+	}
+	for i, w := range want {
+		w.Hive = Coords{Row: 0, Col: 0}
+		if threats[i] != w {
+			t.Errorf("threat %d: %+v, want %+v", i, threats[i], w)
+		}
+	}
+}
+
+func TestClaimThreat(t *testing.T) {
+	near, far, weak := Coords{Row: 0, Col: 2}, Coords{Row: 0, Col: 6}, Coords{Row: 2, Col: 0}
+	gm := &NewAgent(1, DefaultParams()).Map
+	gm.Threats = []Threat{{Enemy: near, Danger: 0.8}, {Enemy: far, Danger: 0.8}, {Enemy: weak, Danger: gm.params.DefendThreat / 2}}
+	bee := &Bee{ID: 1, Pos: Coords{Row: 0, Col: 0}}
+
+	for i, want := range []Coords{near, far, near, near} {
+		got, ok := gm.claimThreat(bee)
+		if !ok || got.Enemy != want {
+			t.Errorf("claim %d: %v, %v, want %v", i, got.Enemy, ok, want)
+		}
+	}
+	if !gm.threatClaims[near] || !gm.threatClaims[far] || gm.threatClaims[weak] {
+		t.Errorf("claims %v, want the two serious threats only", gm.threatClaims)
+	}
+
+	gm.Threats = gm.Threats[2:]
+	if got, ok := gm.claimThreat(bee); ok {
+		t.Errorf("claimed %+v, not worth a defender", got)
+	}
+}
+
+// TestSpawnFaces surrounds our hive: the first idle bee by ID on a face makes
+// room, stepping off the hive's faces
+func TestSpawnFaces(t *testing.T) {
+	hive := Coords{Row: 0, Col: 0}
+	carrier, saboteur, idle := Coords{Row: -1, Col: -1}, Coords{Row: -1, Col: 1}, Coords{Row: 0, Col: 2}
+	ours := func(flower bool) *Entity { return &Entity{Type: BEE, Hp: 2, Player: 0, HasFlower: flower} }
+	gm, _ := defenseMap(map[Coords]*Entity{
+		carrier: ours(true), saboteur: ours(false), idle: ours(false),
+		{Row: 1, Col: -1}: ours(false), {Row: 1, Col: 1}: ours(false),
+		{Row: 0, Col: -2}: {Type: BEE, Hp: 2, Player: 1},
+	})
+	if gm.freeFace(hive) {
+		t.Fatal("hive has a free face")
+	}
+	gm.Tracker.At[saboteur].Role = ROLE_SABOTEUR
+
+	gm.planSpawnFaces()
+	bee := gm.Tracker.At[idle]
+	if len(gm.faceClearers) != 1 || gm.faceClearers[bee.ID] != hive {
+		t.Fatalf("clearers %v, want bee %d at %v", gm.faceClearers, bee.ID, idle)
+	}
+	order, ok := gm.clearFace(bee, hive)
+	if !ok || order.Type != MOVE {
+		t.Fatalf("order %v, %v, want a move", order, ok)
+	}
+	if to := getCoords(idle, order.Direction); dist(to, hive) <= 1 || gm.Mapped[to].Type != EMPTY_HEX {
+		t.Errorf("moves to %v, want a free hex off the hive's faces", to)
+	}
+
+	gm, _ = defenseMap(map[Coords]*Entity{idle: ours(false)})
+	if gm.planSpawnFaces(); len(gm.faceClearers) != 0 {
+		t.Errorf("clearers %v for a hive with free faces", gm.faceClearers)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+The enemy model remembers the enemy bees we have seen. Like BeeTracker it
+gives each one an ID, by matching this turn's sightings to where each
+remembered bee was heading, and it keeps a bee for a while after it goes out
+of sight. A bee that vanishes from a hex we can still see right after we
+attacked it hard enough is counted dead. Per player it also guesses how many
+bees there are from the player's spending, which sees through the fog better
+than our memory: a bee that comes back into sight after a while can't
+always be told from a new one. Deliveries we see are added back to the
+spending, a spawn in the same turn as one would hide behind it. From all of it,
+a danger heatmap is built for pathing and hive placement.
+*/
+
+const (
+	enemyMemory  = 20 // turns an unseen enemy bee is remembered
+	dangerRadius = 2  // a bee in sight threatens this far around it
+)
+
+type EnemyBee struct {
+	ID         int
+	Player     int
+	Pos        Coords // last seen at
+	Step       Coords // its last move as an offset, zero when it stood still
+	HasFlower  bool
+	Hp         int
+	Seen       uint   // turn last seen
+	Heading    Coords // where it seems to be going
+	HasHeading bool
+}
+
+type EnemyPlayer struct {
+	Player     int
+	InSight    int  // bees seen this turn
+	Remembered int  // bees seen in the last enemyMemory turns and not seen dying
+	Killed     int  // bees we saw die to our attacks
+	Spawned    int  // bees its spending says it spawned, hives included
+	Delivered  int  // flowers we saw it bring home
+	Hives      int  // its hives we have seen
+	Resources  uint // as of this turn
+	start      EnemyStart
+}
+
+// EnemyStart is what every player starts with, going by what we start with
+type EnemyStart struct {
+	Bees, Hives int
+}
+
+// Estimate is how many bees the player has, in sight or not: what it
+// started with and spent on bees, less the ones we killed. A hive built
+// costs as much as two bees and takes the place of a third.
+func (p *EnemyPlayer) Estimate() int {
+	hives := max(0, p.Hives-p.start.Hives) * (int(arenaRules.HiveCost/arenaRules.SpawnCost) + 1)
+	return max(p.InSight, p.start.Bees+p.Spawned-hives-p.Killed)
+}
+
+type EnemyModel struct {
+	Bees    map[int]*EnemyBee
+	Players map[int]*EnemyPlayer
+	Danger  map[Coords]float64 // see DangerAt
+	nextID  int
+	start   EnemyStart
+	started bool
+}
+
+func NewEnemyModel() *EnemyModel {
+	return &EnemyModel{
+		Bees:    make(map[int]*EnemyBee),
+		Players: make(map[int]*EnemyPlayer),
+		Danger:  make(map[Coords]float64),
+		nextID:  1,
+	}
+}
+
+// DangerAt is how likely an enemy bee is to be able to hit c soon, roughly
+// the number of enemies in reach: near fresh sightings of bees that fight
+// it is high, old sightings and flower carriers count for less
+func (m *EnemyModel) DangerAt(c Coords) float64 {
+	return m.Danger[c]
+}
+
+// Total is the estimated number of enemy bees, all players together
+func (m *EnemyModel) Total() int {
+	total := 0
+	for _, p := range m.Players {
+		total += p.Estimate()
+	}
+	return total
+}
+
+// sorted returns the remembered bees in ID order
+func (m *EnemyModel) sorted() []*EnemyBee {
+	bees := make([]*EnemyBee, 0, len(m.Bees))
+	for _, b := range m.Bees {
+		bees = append(bees, b)
+	}
+	slices.SortFunc(bees, func(a, b *EnemyBee) int { return a.ID - b.ID })
+	return bees
+}
+
+// predicted is where the bee should be now if it kept going the way it went
+func (b *EnemyBee) predicted(turn uint) Coords {
+	age := int(turn - b.Seen)
+	return Coords{Row: b.Pos.Row + b.Step.Row*age, Col: b.Pos.Col + b.Step.Col*age}
+}
+
+// updateEnemies takes this turn's sightings into the model
+func (gm *GameMap) updateEnemies(state *GameState, player int) {
+	m := gm.Enemies
+	turn := state.Turn
+	if !m.started {
+		m.start = EnemyStart{Bees: len(gm.MyBees), Hives: len(gm.MyHives)}
+		m.started = true
+	}
+
+	attacked := gm.Tracker.Attacked
+
+	sightings := make(map[int][]Coords)
+	for _, c := range sortedKeys(state.Hexes) {
+		if unit := state.Hexes[c].Entity; unit != nil && unit.Type == BEE && unit.Player != player {
+			sightings[unit.Player] = append(sightings[unit.Player], c)
+		}
+	}
+	for p := 0; p < state.NumPlayers && p < len(state.PlayerResources); p++ {
+		if p == player {
+			continue
+		}
+		if m.Players[p] == nil {
+			m.Players[p] = &EnemyPlayer{Player: p, Resources: state.PlayerResources[p], start: m.start}
+		}
+		ep := m.Players[p]
+		ep.InSight = len(sightings[p])
+		ep.Hives = 0
+	}
+	for _, hive := range sortedKeys(gm.EnemyHives) {
+		if tile := gm.Mapped[hive]; tile.Type == ENEMY_HIVE && m.Players[tile.Player] != nil {
+			m.Players[tile.Player].Hives++
+		}
+	}
+
+	//match remembered bees to sightings, closest to where they should be first
+	type pair struct {
+		bee  *EnemyBee
+		at   Coords
+		cost int
+	}
+	var pairs []pair
+	for _, b := range m.sorted() {
+		for _, c := range sightings[b.Player] {
+			if reach := int(turn - b.Seen); dist(b.Pos, c) <= reach {
+				pairs = append(pairs, pair{b, c, dist(b.predicted(turn), c)*4 + dist(b.Pos, c)})
+			}
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b pair) int {
+		if a.cost != b.cost {
+			return a.cost - b.cost
+		}
+		if a.bee.ID != b.bee.ID {
+			return a.bee.ID - b.bee.ID
+		}
+		return compareCoords(a.at, b.at)
+	})
+	matched := make(map[int]bool)
+	taken := make(map[Coords]bool)
+	delivered := make(map[int]int) //by player
+	for _, p := range pairs {
+		if matched[p.bee.ID] || taken[p.at] {
+			continue
+		}
+		matched[p.bee.ID], taken[p.at] = true, true
+		b := p.bee
+		if b.HasFlower && b.Pos == p.at && turn-b.Seen == 1 && !state.Hexes[p.at].Entity.HasFlower {
+			delivered[b.Player]++ //a carrier that stood still and lost its flower brought it home
+		}
+		if age := int(turn - b.Seen); age == 1 {
+			b.Step = Coords{Row: p.at.Row - b.Pos.Row, Col: p.at.Col - b.Pos.Col}
+		} else {
+			b.Step = Coords{}
+		}
+		b.Pos, b.Seen = p.at, turn
+	}
+
+	//what the resources went down by, and what they would have without the deliveries, went on bees
+	for _, p := range sortedPlayers(m.Players) {
+		ep := m.Players[p]
+		res := state.PlayerResources[p]
+		if spent := int(ep.Resources) + delivered[p] - int(res); spent > 0 {
+			ep.Spawned += (spent + int(arenaRules.SpawnCost)/2) / int(arenaRules.SpawnCost)
+		}
+		ep.Resources = res
+		ep.Delivered += delivered[p]
+	}
+
+	//the rest of the sightings are bees we didn't know yet
+	for p := range sightings {
+		for _, c := range sightings[p] {
+			if !taken[c] {
+				b := &EnemyBee{ID: m.nextID, Player: p, Pos: c, Seen: turn}
+				m.nextID++
+				m.Bees[b.ID] = b
+			}
+		}
+	}
+
+	//and the rest of the bees are out of sight, dead or forgotten
+	for _, b := range m.sorted() {
+		if b.Seen == turn {
+			hex := state.Hexes[b.Pos].Entity
+			b.HasFlower, b.Hp = hex.HasFlower, hex.Hp
+			continue
+		}
+		_, visible := state.Hexes[b.Pos]
+		switch {
+		case visible && turn-b.Seen == 1 && attacked[b.Pos] >= hitsToKill(b.Hp):
+			gm.trace.Of(SUB_ENEMY).Info("enemy bee killed", "enemy", b.ID, "player", b.Player, "at", b.Pos)
+			m.Players[b.Player].Killed++
+			delete(m.Bees, b.ID)
+		case turn-b.Seen > enemyMemory:
+			delete(m.Bees, b.ID)
+		}
+	}
+
+	for _, ep := range m.Players {
+		ep.Remembered = 0
+	}
+	for _, b := range m.Bees {
+		m.Players[b.Player].Remembered++
+		if b.Seen == turn {
+			b.Heading, b.HasHeading = gm.enemyHeading(b)
+		}
+	}
+	for _, p := range sortedPlayers(m.Players) {
+		ep := m.Players[p]
+		gm.trace.Of(SUB_ENEMY).Debug("enemy estimate", "player", p, "inSight", ep.InSight, "remembered", ep.Remembered,
+			"spawned", ep.Spawned, "delivered", ep.Delivered, "hives", ep.Hives, "killed", ep.Killed, "estimate", ep.Estimate())
+	}
+	gm.buildDanger(turn)
+}
+
+func sortedPlayers(players map[int]*EnemyPlayer) []int {
+	list := make([]int, 0, len(players))
+	for p := range players {
+		list = append(list, p)
+	}
+	slices.Sort(list)
+	return list
+}
+
+// enemyHeading guesses where a bee is going: a carrier to its nearest hive,
+// anyone else to the nearest flower field
+func (gm *GameMap) enemyHeading(b *EnemyBee) (Coords, bool) {
+	if !b.HasFlower {
+		field, _, ok := gm.NearestFlower(b.Pos)
+		return field, ok
+	}
+	best, bestDist := Coords{}, -1
+	for _, hive := range sortedKeys(gm.EnemyHives) {
+		if tile := gm.Mapped[hive]; tile.Type == ENEMY_HIVE && tile.Player == b.Player && (bestDist < 0 || dist(b.Pos, hive) < bestDist) {
+			best, bestDist = hive, dist(b.Pos, hive)
+		}
+	}
+	return best, bestDist >= 0
+}
+
+// buildDanger spreads every remembered bee over the hexes it could reach.
+// The older the sighting, the wider and thinner, and shifted the way it was
+// heading. Carriers weigh less, they are busy; enemy hives can spawn next to them.
+func (gm *GameMap) buildDanger(turn uint) {
+	m := gm.Enemies
+	clear(m.Danger)
+	spread := func(center Coords, radius int, weight float64) {
+		for r := center.Row - radius; r <= center.Row+radius; r++ {
+			for c := center.Col - 2*radius; c <= center.Col+2*radius; c++ {
+				hex := Coords{Row: r, Col: c}
+				d := dist(center, hex)
+				if d > radius || (r+c)%2 != (center.Row+center.Col)%2 {
+					continue
+				}
+				if _, known := gm.Mapped[hex]; known {
+					m.Danger[hex] += weight * float64(radius+1-d) / float64(radius+1)
+				}
+			}
+		}
+	}
+	for _, b := range m.sorted() {
+		age := int(turn - b.Seen)
+		weight := 1 - float64(age)/float64(enemyMemory+1)
+		if b.HasFlower {
+			weight *= 0.3
+		}
+		center := b.Pos
+		if b.HasHeading && age > 0 {
+			for i := 0; i < age && center != b.Heading; i++ {
+				center = towards(center, b.Heading)
+			}
+		}
+		spread(center, dangerRadius+min(age, 3), weight/float64(1+min(age, 3)))
+	}
+	for _, hive := range sortedKeys(gm.EnemyHives) {
+		spread(hive, dangerRadius, 1)
+	}
+}
+
+// towards is the neighbour of c closest to target
+func towards(c, target Coords) Coords {
+	best := c
+	for _, dir := range dirs {
+		if n := getCoords(c, dir); dist(n, target) < dist(best, target) {
+			best = n
+		}
+	}
+	return best
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+func TestEstimate(t *testing.T) {
+	start := EnemyStart{Bees: 2, Hives: 1}
+	tests := []struct {
+		name string
+		p    EnemyPlayer
+		want int
+	}{
+		{"as it started", EnemyPlayer{}, 2},
+		{"spawned", EnemyPlayer{Spawned: 3}, 5},
+		{"killed", EnemyPlayer{Spawned: 3, Killed: 4}, 1},
+		{"built a hive from a bee", EnemyPlayer{Spawned: 3 + 2, Hives: 2}, 4},
+		{"built two hives", EnemyPlayer{Spawned: 4 + 4, Hives: 3}, 4},
+		{"more in sight than spent", EnemyPlayer{InSight: 6, Spawned: 1}, 6},
+		{"more killed than it had", EnemyPlayer{Killed: 5}, 0},
+	}
+	for _, tt := range tests {
+		tt.p.start = start
+		if got := tt.p.Estimate(); got != tt.want {
+			t.Errorf("%s: estimate %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// enemyStates is a turn of ours next to player 1's hive, then the next one
+// with the changes made: bees by position, resources as [ours, theirs]
+func enemyStates(bees []map[Coords]*Entity, resources [][]uint) []*GameState {
+	states := make([]*GameState, len(bees))
+	for i := range states {
+		s := &GameState{NumPlayers: 2, Turn: uint(i), Hexes: map[Coords]*Hex{}, PlayerResources: resources[i]}
+		for r := -2; r <= 6; r++ {
+			for c := -2; c <= 8; c++ {
+				if (r+c)%2 == 0 {
+					s.Hexes[Coords{Row: r, Col: c}] = &Hex{Terrain: EMPTY}
+				}
+			}
+		}
+		s.Hexes[Coords{Row: 0, Col: 0}].Entity = &Entity{Type: HIVE, Hp: 12, Player: 0}
+		s.Hexes[Coords{Row: 4, Col: 4}].Entity = &Entity{Type: HIVE, Hp: 12, Player: 1}
+		for c, e := range bees[i] {
+			s.Hexes[c].Entity = e
+		}
+		states[i] = s
+	}
+	return states
+}
+
+// TestSpendingBehindDeliveries has player 1 bring home four flowers and
+// spawn a bee in the same turn, its resources going down by only 2
+func TestSpendingBehindDeliveries(t *testing.T) {
+	ours := Coords{Row: 0, Col: 2}
+	carriers := []Coords{{Row: 4, Col: 6}, {Row: 5, Col: 5}, {Row: 5, Col: 3}, {Row: 4, Col: 2}}
+	before := map[Coords]*Entity{ours: {Type: BEE, Hp: 2, Player: 0}}
+	after := map[Coords]*Entity{ours: {Type: BEE, Hp: 2, Player: 0}, {Row: 3, Col: 3}: {Type: BEE, Hp: 2, Player: 1}}
+	for _, c := range carriers {
+		before[c] = &Entity{Type: BEE, Hp: 2, Player: 1, HasFlower: true}
+		after[c] = &Entity{Type: BEE, Hp: 2, Player: 1}
+	}
+	gm := &NewAgent(1, DefaultParams()).Map
+	for _, s := range enemyStates([]map[Coords]*Entity{before, after}, [][]uint{{6, 6}, {6, 4}}) {
+		gm.updateGameMap(s, 0)
+	}
+	ep := gm.Enemies.Players[1]
+	if ep.Delivered != 4 || ep.Spawned != 1 {
+		t.Errorf("delivered %d, spawned %d, want 4 and 1", ep.Delivered, ep.Spawned)
+	}
+}
+
+// TestKillOutsideSkirmish counts a kill from an ATTACK order that did not
+// come from the skirmish planner, like a saboteur's or a defender's
+func TestKillOutsideSkirmish(t *testing.T) {
+	ours, theirs := Coords{Row: 0, Col: 2}, Coords{Row: 0, Col: 4}
+	before := map[Coords]*Entity{ours: {Type: BEE, Hp: 2, Player: 0}, theirs: {Type: BEE, Hp: 1, Player: 1}}
+	after := map[Coords]*Entity{ours: {Type: BEE, Hp: 2, Player: 0}}
+	states := enemyStates([]map[Coords]*Entity{before, after}, [][]uint{{6, 6}, {6, 6}})
+
+	gm := &NewAgent(1, DefaultParams()).Map
+	gm.updateGameMap(states[0], 0)
+	gm.Tracker.RecordOrder(Order{Type: ATTACK, Coords: ours, Direction: E})
+	gm.updateGameMap(states[1], 0)
+	if killed := gm.Enemies.Players[1].Killed; killed != 1 {
+		t.Errorf("killed %d, want 1", killed)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"container/heap"
+)
+
+import . "hive-arena/common"
+
+// fieldCell is the walking distance from a hex to the nearest source, and which source that is
+type fieldCell struct {
+	Dist   int
+	Source Coords
+}
+
+// DistanceField maps every hex that can reach a source to its fieldCell (flow map)
+type DistanceField map[Coords]fieldCell
+
+// distanceFields are kept on the GameMap and updated as the map changes.
+// A hex that gets easier to walk (newly revealed, a wall gone) and a new flower
+// field can only shorten distances, so the fields are relaxed outwards from
+// it. A hex that gets harder to walk, or a field running out, can lengthen
+// them: only the fields that reached that hex are rebuilt. A new hive builds
+// its own field and merges it into the nearest-hive field.
+type distanceFields struct {
+	flowersDirty bool                     // rebuild the flower field
+	hivesDirty   bool                     // merge the nearest-hive field again from perHive
+	opened       []Coords                 // hexes that got easier to walk, to relax from
+	newFlowers   []Coords                 // flower fields that are new sources
+	hives        DistanceField            // to standing next to the nearest own hive
+	perHive      map[Coords]DistanceField // to standing next to that hive
+	flowers      DistanceField            // to standing on the nearest non-empty flower field
+}
+
+func newDistanceFields() distanceFields {
+	return distanceFields{
+		flowersDirty: true,
+		hives:        make(DistanceField),
+		perHive:      make(map[Coords]DistanceField),
+		flowers:      make(DistanceField),
+	}
+}
+
+// fieldWalkable ignores bees, they move; walls can be broken
+func fieldWalkable(tile GameMapObject) bool {
+	switch tile.Type {
+	case EMPTY_HEX, ENEMY_WALL, OWN_BEE, EXPLORER, ENEMY_BEE:
+		return true
+	}
+	return false
+}
+
+type fieldItem struct {
+	hex    Coords
+	dist   int
+	source Coords
+}
+
+type fieldQueue []fieldItem
+
+func (q fieldQueue) Len() int           { return len(q) }
+func (q fieldQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q fieldQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *fieldQueue) Push(x any)        { *q = append(*q, x.(fieldItem)) }
+func (q *fieldQueue) Pop() any {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
+
+/*
+buildField runs Dijkstra outwards from all sources at once: the cost of walking
+from each hex to the nearest source. With adjacent, the goal is to stand next to
+a source (hives) rather than on it. Costs are the same as aStar's.
+*/
+func (gm *GameMap) buildField(sources []Coords, adjacent bool, walkable func(GameMapObject) bool) DistanceField {
+	return gm.buildFieldAround(sources, adjacent, walkable, nil)
+}
+
+// buildFieldAround is buildField as if the blocked hexes couldn't be walked
+func (gm *GameMap) buildFieldAround(sources []Coords, adjacent bool, walkable func(GameMapObject) bool, blocked map[Coords]bool) DistanceField {
+	canWalk := func(hex Coords) bool { return !blocked[hex] && walkable(gm.Mapped[hex]) }
+	field := make(DistanceField)
+	q := fieldQueue{}
+	start := func(hex, source Coords) {
+		if old, ok := field[hex]; ok && old.Dist == 0 {
+			return
+		}
+		field[hex] = fieldCell{0, source}
+		q = append(q, fieldItem{hex, 0, source})
+	}
+	for _, s := range sources {
+		if !adjacent {
+			start(s, s)
+			continue
+		}
+		for _, dir := range dirs {
+			n := getCoords(s, dir)
+			if canWalk(n) {
+				start(n, s)
+			}
+		}
+	}
+	heap.Init(&q)
+	gm.spread(field, &q, canWalk)
+	return field
+}
+
+// spread runs Dijkstra from the queued cells, lowering field wherever it gets shorter
+func (gm *GameMap) spread(field DistanceField, q *fieldQueue, canWalk func(Coords) bool) {
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(fieldItem)
+		if cur.dist > field[cur.hex].Dist {
+			continue
+		}
+		step := cur.dist + gm.enterCost(gm.Mapped[cur.hex]) //walking from a neighbour into cur
+		for _, dir := range dirs {
+			n := getCoords(cur.hex, dir)
+			if !canWalk(n) {
+				continue
+			}
+			if old, ok := field[n]; ok && old.Dist <= step {
+				continue
+			}
+			field[n] = fieldCell{step, cur.source}
+			heap.Push(q, fieldItem{n, step, cur.source})
+		}
+	}
+}
+
+// relaxField lowers field after the hexes got easier to walk or became
+// sources. start says whether a hex is a goal itself, and for which source.
+func (gm *GameMap) relaxField(field DistanceField, hexes []Coords, start func(Coords) (Coords, bool)) {
+	canWalk := func(hex Coords) bool { return fieldWalkable(gm.Mapped[hex]) }
+	q := fieldQueue{}
+	for _, hex := range hexes {
+		if !canWalk(hex) {
+			continue
+		}
+		best, ok := field[hex]
+		if source, isStart := start(hex); isStart {
+			best, ok = fieldCell{0, source}, true
+		}
+		for _, dir := range dirs {
+			n := getCoords(hex, dir)
+			if cell, in := field[n]; in && canWalk(n) {
+				if d := cell.Dist + gm.enterCost(gm.Mapped[n]); !ok || d < best.Dist {
+					best, ok = fieldCell{d, cell.Source}, true
+				}
+			}
+		}
+		if ok {
+			field[hex] = best
+			q = append(q, fieldItem{hex, best.Dist, best.Source})
+		}
+	}
+	heap.Init(&q)
+	gm.spread(field, &q, canWalk)
+}
+
+// setTile is the one way tiles of Mapped are written, so the distance fields hear of every change
+func (gm *GameMap) setTile(c Coords, tile GameMapObject) {
+	gm.noteTileChange(c, gm.Mapped[c], tile)
+	gm.Mapped[c] = tile
+}
+
+// noteTileChange works out which distance fields a tile change affects
+func (gm *GameMap) noteTileChange(c Coords, old, cur GameMapObject) {
+	f := &gm.fields
+	wasWalkable, walkable := fieldWalkable(old), fieldWalkable(cur)
+	switch {
+	case wasWalkable && (!walkable || gm.enterCost(cur) > gm.enterCost(old)): //harder: rebuild what went through c
+		for hive, field := range f.perHive {
+			if _, in := field[c]; in {
+				delete(f.perHive, hive)
+				f.hivesDirty = true
+			}
+		}
+		if _, in := f.flowers[c]; in {
+			f.flowersDirty = true
+		}
+	case walkable && (!wasWalkable || gm.enterCost(cur) < gm.enterCost(old)): //easier: relax from c
+		f.opened = append(f.opened, c)
+	}
+	if old.Flowers > 0 && cur.Flowers == 0 {
+		f.flowersDirty = true
+	} else if old.Flowers == 0 && cur.Flowers > 0 {
+		f.newFlowers = append(f.newFlowers, c)
+	}
+}
+
+// hiveGoal is whether c is a goal of hive's field
+func hiveGoal(hive Coords) func(Coords) (Coords, bool) {
+	return func(c Coords) (Coords, bool) { return hive, dist(c, hive) == 1 }
+}
+
+// refreshFields brings the distance fields up to date, doing as little as it can
+func (gm *GameMap) refreshFields() {
+	f := &gm.fields
+	if len(f.opened) > 0 {
+		for _, hive := range sortedKeys(f.perHive) {
+			gm.relaxField(f.perHive[hive], f.opened, hiveGoal(hive))
+		}
+		if !f.hivesDirty {
+			gm.relaxField(f.hives, f.opened, func(c Coords) (Coords, bool) {
+				for _, hive := range sortedKeys(gm.MyHives) {
+					if dist(c, hive) == 1 {
+						return hive, true
+					}
+				}
+				return Coords{}, false
+			})
+		}
+	}
+	if !f.flowersDirty && len(f.opened)+len(f.newFlowers) > 0 {
+		gm.relaxField(f.flowers, append(f.opened, f.newFlowers...), func(c Coords) (Coords, bool) { return c, gm.FlowerFields[c] })
+	}
+	f.opened, f.newFlowers = f.opened[:0], f.newFlowers[:0]
+
+	if f.hivesDirty {
+		clear(f.hives)
+	}
+	for hive := range f.perHive {
+		if !gm.MyHives[hive] { //destroyed
+			delete(f.perHive, hive)
+			clear(f.hives)
+			f.hivesDirty = true
+		}
+	}
+	for _, hive := range sortedKeys(gm.MyHives) { //in order, so ties between hives always go the same way
+		field, ok := f.perHive[hive]
+		if !ok {
+			field = gm.buildField([]Coords{hive}, true, fieldWalkable)
+			f.perHive[hive] = field
+		} else if !f.hivesDirty {
+			continue
+		}
+		for hex, cell := range field { //merge the hive into the nearest-hive field
+			if old, ok := f.hives[hex]; !ok || cell.Dist < old.Dist || (cell.Dist == old.Dist && compareCoords(cell.Source, old.Source) < 0) {
+				f.hives[hex] = cell
+			}
+		}
+	}
+	f.hivesDirty = false
+	if f.flowersDirty {
+		var fields []Coords
+		for _, c := range sortedKeys(gm.FlowerFields) {
+			if gm.FlowerFields[c] {
+				fields = append(fields, c)
+			}
+		}
+		f.flowers = gm.buildField(fields, false, fieldWalkable)
+		f.flowersDirty = false
+	}
+}
+
+// NearestHive is the own hive c can walk to soonest, and how many moves it takes to be next to it
+func (gm *GameMap) NearestHive(c Coords) (Coords, int, bool) {
+	gm.refreshFields()
+	cell, ok := gm.fields.hives[c]
+	return cell.Source, cell.Dist, ok
+}
+
+// HiveDistance is the moves needed from c to stand next to hive
+func (gm *GameMap) HiveDistance(hive, c Coords) (int, bool) {
+	gm.refreshFields()
+	cell, ok := gm.fields.perHive[hive][c]
+	return cell.Dist, ok
+}
+
+// NearestFlower is the non-empty flower field c can walk to soonest, and how far it is
+func (gm *GameMap) NearestFlower(c Coords) (Coords, int, bool) {
+	gm.refreshFields()
+	cell, ok := gm.fields.flowers[c]
+	return cell.Source, cell.Dist, ok
+}
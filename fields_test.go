@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+// sameDistances fails unless got has the same hexes at the same distances as want
+func sameDistances(t *testing.T, turn uint, what string, got, want DistanceField) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("turn %d: %s field has %d hexes, a rebuild has %d", turn, what, len(got), len(want))
+	}
+	for hex, cell := range want {
+		if got[hex].Dist != cell.Dist {
+			t.Fatalf("turn %d: %s field has %v at %d, a rebuild has %d", turn, what, hex, got[hex].Dist, cell.Dist)
+		}
+	}
+}
+
+// TestFieldsMatchRebuild plays a game and checks, every turn, that the
+// incrementally kept distance fields are what building them afresh gives
+func TestFieldsMatchRebuild(t *testing.T) {
+	const seed = 3
+	rules := sim.DefaultRules()
+	rules.MaxTurns = 150
+	g := sim.NewGame(sim.Generate(sim.Presets["balanced"], 2, rules, seed), 2, rules, seed)
+	a := NewAgent(seed, DefaultParams())
+	players := []sim.Player{
+		func(state *GameState, player int) []Order {
+			out := &OrderSet{}
+			a.Think(context.Background(), state, player, out)
+			gm := &a.Map
+			gm.refreshFields()
+			hives := sortedKeys(gm.MyHives)
+			sameDistances(t, state.Turn, "nearest hive", gm.fields.hives, gm.buildField(hives, true, fieldWalkable))
+			for _, hive := range hives {
+				sameDistances(t, state.Turn, "hive", gm.fields.perHive[hive], gm.buildField([]Coords{hive}, true, fieldWalkable))
+			}
+			var flowers []Coords
+			for _, c := range sortedKeys(gm.FlowerFields) {
+				if gm.FlowerFields[c] {
+					flowers = append(flowers, c)
+				}
+			}
+			sameDistances(t, state.Turn, "flower", gm.fields.flowers, gm.buildField(flowers, false, fieldWalkable))
+			return out.Close()
+		},
+		simPlayer(seed+1, DefaultParams(), NoTrace()),
+	}
+	sim.Play(g, players)
+}
@@ -1,30 +1,57 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	. "hive-arena/common"
 )
 
 var dirs = []Direction{E, SE, SW, W, NW, NE}
-var gameMap GameMap
-var exploring bool
-var should_build_hive bool = false
-
-var previousDirection Coords
-var activeExplorerCoords Coords
-var previousExplorerCoords Coords
-var explorerTarget = Coords{Row: -100, Col: -100}
-
-var (
-	HasExplorer    bool    = false
-	BeesPerHive    int     = 5
-	ScoreThreshold float64 = 140.0
-)
+
+// Agent is one player in one game: its map and everything it remembers
+// between turns. Agents share nothing, so a process can play several games.
+type Agent struct {
+	Map   GameMap
+	tasks *TaskAllocator
+	roles *RoleManager
+
+	Params Params
+	Seed   int64 // of Map's random source
+
+	player          int
+	exploring       bool
+	shouldBuildHive bool
+	unknownCount    int
+	explorerTarget  Coords
+	nextWallPlan    uint      // turn to look for a wall site again
+	lastOut         *OrderSet // last turn's orders, Sent once the turn is over
+}
+
+func NewAgent(seed int64, params Params) *Agent {
+	a := &Agent{
+		Map:            NewGameMap(),
+		tasks:          NewTaskAllocator(),
+		roles:          NewRoleManager(),
+		Params:         params,
+		exploring:      true,
+		explorerTarget: Coords{Row: -100, Col: -100},
+		Seed:           seed,
+	}
+	a.Map.rng = rand.New(rand.NewSource(seed))
+	a.Map.params = &a.Params
+	return a
+}
 
 func dist(one, two Coords) int {
 	dx := one.Row - two.Row
@@ -43,121 +70,89 @@ func dist(one, two Coords) int {
 	return dx + (dy-dx)/2
 }
 
-func IdentifyExplorer(gm *GameMap) {
-	if !HasExplorer {
-		RecruitNewExplorer(gm)
-		return
-	}
-
-	if isMyBee(previousExplorerCoords, gm) {
-		activeExplorerCoords = previousExplorerCoords
-		return
-	}
-
-	// Check neighbors (maybe they moved)
-	for _, offset := range directionToOffset {
-		neighbor := addCoords(previousExplorerCoords, offset)
-		if isMyBee(neighbor, gm) {
-			activeExplorerCoords = neighbor
-			// Found them! Update the "previous" tracker for next turn
-			previousExplorerCoords = neighbor
-			return
-		}
+// compareCoords orders coordinates row by row, for a stable order over map keys
+func compareCoords(a, b Coords) int {
+	if a.Row != b.Row {
+		return a.Row - b.Row
 	}
-
-	// We must recruit a replacement.
-	// fmt.Println("Explorer MIA! Recruiting replacement...")
-	RecruitNewExplorer(gm)
+	return a.Col - b.Col
 }
 
-func isMyBee(c Coords, gm *GameMap) bool {
-	tile, ok := gm.Mapped[c]
-	return ok && tile.Type == OWN_BEE
+// closer tells whether c is nearer to from than best (at bestDist), ties
+// going to the smaller coordinates so the answer doesn't depend on map order
+func closer(from, c, best Coords, bestDist int) bool {
+	d := dist(from, c)
+	return d < bestDist || (d == bestDist && compareCoords(c, best) < 0)
 }
 
-func RecruitNewExplorer(gm *GameMap) {
-	// Simple logic: Pick bee furthest from Hive (closest to the unknown)
-	var bestBee Coords
-	maxDist := -1
-	found := false
-
-	for coords, tile := range gm.Mapped {
-		if tile.Type == OWN_BEE && !tile.BeeHasFlower {
-			d := getDistanceToNearestHive(coords, gm)
-			if d > maxDist {
-				maxDist = d
-				bestBee = coords
-				found = true
-			}
-		}
-	}
-
-	if found {
-		activeExplorerCoords = bestBee
-		previousExplorerCoords = bestBee
-		HasExplorer = true
-		// fmt.Printf("Recruited NEW Explorer at %v\n", bestBee)
-		tile := gameMap.Mapped[activeExplorerCoords]
-		tile.Type = EXPLORER
-		gameMap.Mapped[activeExplorerCoords] = tile
-	} else {
-		HasExplorer = false
+// sortedKeys lists a map's coordinates in compareCoords order
+func sortedKeys[V any](m map[Coords]V) []Coords {
+	keys := make([]Coords, 0, len(m))
+	for c := range m {
+		keys = append(keys, c)
 	}
+	slices.SortFunc(keys, compareCoords)
+	return keys
 }
 
-func goHome(h Hex, coords Coords) Order {
-	distance := 20000
-	var o Order
-	var target Coords
-	o.Coords = coords
-	o.Type = MOVE
-	for key, _ := range gameMap.MyHives { //find closest hive
-		if distance > dist(key, coords) {
-			distance = dist(key, coords)
-			target = key
+func (a *Agent) goHome(h Hex, coords Coords) Order {
+	gm := &a.Map
+	target, _, found := gm.NearestHive(coords) //the hive we can walk to soonest
+	for key, _ := range gm.MyHives {
+		if dist(key, coords) == 1 { //if next to a hive of yours, put flower
+			gm.explain(coords, key, "next to hive %v, dropping the flower", key)
+			return Order{Type: FORAGE, Coords: coords}
 		}
 	}
-	if distance == 1 { //if next to a hive of yours, put flower
-		o.Type = FORAGE
-		return o
-	}
-	temp := aStar(coords, target, true, &gameMap) //a-star algorithm to find path, boolean true tells it to stop next to target, not on it
-	if (temp != Order{}) {
-		return temp
+	if found {
+		cost := SafeCost.NoWalls() //a carrier breaking a wall is a sitting target
+		if !gm.reaches(coords, target, true, cost) {
+			cost = SafeCost
+		}
+		if temp, ok := aStar(coords, target, true, cost, gm); ok { //stop next to the hive, not on it
+			gm.explain(coords, target, "carrying a flower to hive %v", target)
+			return temp
+		}
 	}
+	gm.explain(coords, coords, "carrying a flower, no way home known: random move")
 	return (Order{
 		Type:      MOVE,
 		Coords:    coords,
-		Direction: dirs[rand.Intn(len(dirs))],
+		Direction: a.Map.randomDir(),
 	}) //fallback: try a random move. TODO:move to random empty hex, not random hex
 }
 
-func isEmpty(c Coords, d Direction) bool {
+func (gm *GameMap) isEmpty(c Coords, d Direction) bool {
 	target := Coords{
 		Row: c.Row + DirectionToOffset[d].Row,
 		Col: c.Col + DirectionToOffset[d].Col,
 	}
-	return gameMap.Mapped[target].IsWalkable
+	return gm.Mapped[target].IsWalkable
 }
 
+// getNearestFlower returns the flower field with the shortest walk from coords,
+// or the closest one on the map if none can be walked to yet
 func (gm *GameMap) getNearestFlower(coords Coords) Coords {
+	if field, _, ok := gm.NearestFlower(coords); ok {
+		return field
+	}
 	distance := 20000
 	field := Coords{}
 	for temp, there := range gm.FlowerFields {
-		if there && dist(coords, temp) < distance {
+		if there && closer(coords, temp, field, distance) {
 			distance = dist(coords, temp)
 			field = temp
 		}
-		//TODO: pathfound distance rather than map distance
 	}
 	return field
 }
 
-func (gm *GameMap) getNearestUnknown(coords Coords) Coords {
-	if explorerTarget.Row != -100 {
-		tile, exists := gm.Mapped[explorerTarget]
+func (a *Agent) getNearestUnknown(coords Coords) Coords {
+	gm := &a.Map
+	if a.explorerTarget.Row != -100 {
+		tile, exists := gm.Mapped[a.explorerTarget]
 		if exists && tile.Type == UNKNOWN {
-			return explorerTarget
+			return a.explorerTarget
 		}
 	}
 	distance := math.MaxInt16
@@ -165,70 +160,84 @@ func (gm *GameMap) getNearestUnknown(coords Coords) Coords {
 	found := false
 	for temp, tile := range gm.Mapped {
 		if tile.Type == UNKNOWN {
-			temp_distance := dist(coords, temp)
-			if temp_distance < distance {
-				distance = temp_distance
+			if closer(coords, temp, target, distance) {
+				distance = dist(coords, temp)
 				target = temp
 				found = true
 			}
 		}
 	}
 	if found {
-		// fmt.Println("New Explorer Target Acquired: ", target)
-		explorerTarget = target
+		if target != a.explorerTarget {
+			gm.trace.Of(SUB_EXPLORE).Debug("new explorer target", "target", target, "from", coords)
+		}
+		a.explorerTarget = target
 		return target
 	}
 	return coords
 }
 
-func beeOrder(h Hex, coords Coords, player int) Order {
+func (a *Agent) beeOrder(h Hex, coords Coords, player int) Order {
 	if h.Entity.HasFlower { //if carrying a flower, go home
-		return goHome(h, coords)
+		return a.goHome(h, coords)
 	} else if h.Resources > 0 { //if in a field, pick up a flower
+		a.Map.explain(coords, coords, "on a field with %d flowers, picking one", h.Resources)
 		return (Order{
 			Type:      FORAGE,
 			Coords:    coords,
-			Direction: dirs[rand.Intn(len(dirs))],
+			Direction: a.Map.randomDir(),
 		})
 	} else {
-		target := gameMap.getNearestFlower(coords)
-		temp := aStar(coords, target, false, &gameMap)
-		if (temp != Order{}) {
-			return temp
+		target, assigned := a.tasks.fieldFor(a.Map.Tracker.At[coords])
+		how := "assigned"
+		if !assigned {
+			target = a.Map.getNearestFlower(coords)
+			how = "nearest"
 		}
+		if temp, ok := aStar(coords, target, false, UniformCost, &a.Map); ok {
+			if temp.Type == "" {
+				a.Map.explain(coords, target, "waiting for another bee to pass on the way to %s field %v", how, target)
+			} else {
+				a.Map.explain(coords, target, "heading to %s field %v", how, target)
+			}
+			return temp //empty if it has to let another bee pass first
+		}
+		a.Map.explain(coords, target, "no path to %s field %v: random move", how, target)
 		return (Order{ //fallback: random move
 			Type:      MOVE,
 			Coords:    coords,
-			Direction: dirs[rand.Intn(len(dirs))],
+			Direction: a.Map.randomDir(),
 		})
 	}
 }
 
-func exploreOrder(h Hex, coords Coords, player int) Order {
-	target := gameMap.getNearestUnknown(coords)
+func (a *Agent) exploreOrder(h Hex, coords Coords, player int) Order {
+	target := a.getNearestUnknown(coords)
 	if target == coords {
+		a.Map.explain(coords, coords, "nothing unknown left: random move")
 		return (Order{ //fallback: random move
 			Type:      MOVE,
 			Coords:    coords,
-			Direction: dirs[rand.Intn(len(dirs))],
+			Direction: a.Map.randomDir(),
 		})
 
 	}
-	temp := aStar(coords, target, true, &gameMap)
-	if (temp != Order{}) {
+	if temp, ok := aStar(coords, target, true, UniformCost, &a.Map); ok {
+		a.Map.explain(coords, target, "exploring towards unknown %v", target)
 		return temp
 	}
 	// If A* still fails (e.g., surrounded by rocks), try random move
+	a.Map.explain(coords, target, "no path to unknown %v: random move", target)
 	return Order{
 		Type:      MOVE,
 		Coords:    coords,
-		Direction: dirs[rand.Intn(len(dirs))],
+		Direction: a.Map.randomDir(),
 	}
 }
 
-func spawnBee(c Coords, player int) Order {
+func (gm *GameMap) spawnBee(c Coords, player int) Order {
 	for _, dir := range dirs {
-		if isEmpty(c, dir) {
+		if gm.isEmpty(c, dir) {
 			return (Order{
 				Type:      SPAWN,
 				Coords:    c,
@@ -239,161 +248,331 @@ func spawnBee(c Coords, player int) Order {
 	return Order{}
 }
 
-func (gm *GameMap) getNearestFreeBee(c Coords) Coords {
-	var closest Coords = Coords{}
-	distance := 20000
-	for loc, _ := range gm.MyBees {
-		if gm.Mapped[loc].BeeHasFlower {
-			continue
-		}
-		d := dist(loc, c)
-		if d < distance {
-			distance = d
-			closest = loc
+// explain notes where the bee at c is going and why, for the debugger and the trace
+func (gm *GameMap) explain(c, goal Coords, format string, args ...any) {
+	if bee := gm.Tracker.At[c]; bee != nil {
+		bee.Goal = goal
+		gm.describe(bee, format, args...)
+	}
+}
+
+// note is explain for a bee whose role has set its Task
+func (gm *GameMap) note(bee *Bee, format string, args ...any) {
+	bee.Goal = bee.Task
+	gm.describe(bee, format, args...)
+}
+
+// describe sets why the bee got its order and traces it under the bee's role.
+// The text is only built when someone will read it.
+func (gm *GameMap) describe(bee *Bee, format string, args ...any) {
+	sub := roleSubsystem(bee.Role)
+	if !gm.explaining && !gm.trace.Enabled(sub, slog.LevelDebug) {
+		return
+	}
+	bee.Reason = fmt.Sprintf(format, args...)
+	gm.trace.Of(sub).Debug(bee.Reason, beeAttr(bee), "goal", bee.Goal)
+}
+
+// releaseLost clears the jobs of bees that died since last turn
+func (a *Agent) releaseLost() {
+	gm := &a.Map
+	for _, bee := range gm.Tracker.Died {
+		switch bee.Role {
+		case ROLE_BUILDER:
+			gm.IsBuilding = false
+		case ROLE_BLOCKER:
+			gm.TargetHive = Coords{}
+		case ROLE_SABOTEUR:
+			gm.IsBlocking[bee.Target] = false //someone else can go
 		}
 	}
-	return closest
 }
 
-func think(state *GameState, player int) []Order {
-	var orders []Order
-	gameMap.updateGameMap(state, player)
-	gameMap.ExpandFringe()
-	gameMap.updateExploringStatus()
-	if exploring && len(gameMap.MyBees) > 2 {
-		RecruitNewExplorer(&gameMap)
+// wantedRoles decides how many bees each managed role should have this turn,
+// and picks the hive to build or block when a builder or blocker is wanted
+func (a *Agent) wantedRoles(state *GameState, player int) map[RoleKind]int {
+	gameMap := &a.Map
+	want := make(map[RoleKind]int)
+	if a.exploring && len(gameMap.MyBees) > 2 {
+		want[ROLE_EXPLORER] = 1
 	}
 
 	//building a new hive logic
-	gameMap.updateBuilderLoc()
 	loc, score := gameMap.bestNewHivePos()
-	if !exploring || Unknown_count < 7 || score > ScoreThreshold {
-		should_build_hive = true
-		if len(gameMap.MyHives) < 2 && state.PlayerResources[player] >= 12 {
-			println("score: ", score)
-			println("scorethreshold: ", ScoreThreshold)
+	if !a.exploring || a.unknownCount < a.Params.BuildUnknown || score > a.Params.ScoreThreshold {
+		a.shouldBuildHive = true
+		if len(gameMap.MyHives) < a.Params.MaxHives && state.PlayerResources[player] >= arenaRules.HiveCost {
+			gameMap.trace.Of(SUB_BUILD).Info("building a hive", "site", loc, "score", score, "threshold", a.Params.ScoreThreshold)
 			gameMap.IsBuilding = true
 			gameMap.BuildTarget = loc
-			gameMap.Builders[0] = gameMap.getNearestFreeBee(loc)
-			should_build_hive = false
-			orders = append(orders, gameMap.goBuild())
+			want[ROLE_BUILDER] = 1
+			a.shouldBuildHive = false
 		}
 	}
-	if len(gameMap.MyHives) >= 2 {
-		should_build_hive = false
+	if len(gameMap.MyHives) >= a.Params.MaxHives {
+		a.shouldBuildHive = false
+	}
+
+	if a.planWalls(state, player) {
+		want[ROLE_WALLER] = 1
 	}
 
 	//sending out blockers logic
-	gameMap.updateBlockers()
 	if (gameMap.TargetHive == Coords{}) {
-		newBlocker := (len(gameMap.MyBees) >= BeesPerHive*len(gameMap.MyHives))
-		// fmt.Printf("[TURN %d DEBUG] Blocker Check: Bees=%d/%d | CurrentBlockers=%d | AllowNew=%v\n", state.Turn, len(gameMap.MyBees), BeesPerHive*len(gameMap.MyHives), gameMap.blockerCount(), newBlocker)
-		if !exploring && newBlocker && gameMap.blockerCount() < state.NumPlayers-1 { //we should make a new blocker
+		newBlocker := (len(gameMap.MyBees) >= a.Params.BeesPerHive*len(gameMap.MyHives))
+		gameMap.trace.Of(SUB_BLOCK).Debug("blocker check", "bees", len(gameMap.MyBees), "wanted", a.Params.BeesPerHive*len(gameMap.MyHives),
+			"blocking", gameMap.blockerCount(), "allowNew", newBlocker)
+		if !a.exploring && newBlocker && gameMap.blockerCount() < state.NumPlayers-1 { //we should make a new blocker
 			gameMap.makeBlockTargets()
-			for hive, _ := range gameMap.EnemyHives {
+			for _, hive := range sortedKeys(gameMap.EnemyHives) {
 				if !gameMap.IsBlocking[hive] { //reject hives already blocked
-					gameMap.TargetHive = hive              //set this hive as target
-					target := gameMap.BlockerTargets[hive] //target for the bee to go to
-					nearestBee := gameMap.getNearestFreeBee(target)
-					// fmt.Printf("[TURN %d DEBUG] ⚔️ ASSIGNING BLOCKER! Bee %v -> Hive %v (Target Spot: %v)\n", state.Turn, nearestBee, hive, target)
-					gameMap.BlockerPositions[0] = nearestBee
-					orders = append(orders, gameMap.goSabotage(hive, target, nearestBee))
+					gameMap.trace.Of(SUB_BLOCK).Info("sending a blocker", "hive", hive, "spot", gameMap.BlockerTargets[hive])
+					gameMap.TargetHive = hive //set this hive as target
 					break
 				}
 			}
 		}
-	} else {
-		bee := gameMap.BlockerPositions[0]
-		target := gameMap.BlockerTargets[gameMap.TargetHive]
-		// fmt.Printf("[TURN %d DEBUG] 🏃 Blocker %v is moving toward %v\n", state.Turn, bee, target)
-		orders = append(orders, gameMap.goSabotage(gameMap.TargetHive, target, bee))
-	}
-
-	//permablockers logic
-	for bee, _ := range gameMap.MySaboteurs {
-		targetHive := Coords{}
-		for hive, _ := range gameMap.EnemyHives {
-			if dist(hive, bee) == 1 {
-				targetHive = hive
-				break
-			}
-		}
-		orders = append(orders, gameMap.attackOrWait(targetHive, bee))
+	}
+	if (gameMap.TargetHive != Coords{}) {
+		want[ROLE_BLOCKER] = 1
 	}
 
-	//basic bee logic
-	for coords, hex := range gameMap.MyBees { //first, order flowerbees
-		if hex != nil && hex.Entity.HasFlower {
-			orders = append(orders, beeOrder(*hex, coords, player))
+	//one defender per serious threat to our hives, as long as most bees still forage
+	gameMap.Threats = gameMap.findThreats(state, player)
+	clear(gameMap.threatClaims)
+	want[ROLE_DEFENDER] = min(len(gameMap.seriousThreats()), len(gameMap.MyBees)/3)
+	return want
+}
+
+// Think is the Agent's Strategy.
+func (a *Agent) Think(ctx context.Context, state *GameState, player int, out *OrderSet) {
+	a.player = player
+	gameMap := &a.Map
+	gameMap.trace.Turn = state.Turn
+	if a.lastOut != nil { //the tracker expects what actually went out last turn, fallback included
+		for _, o := range a.lastOut.Sent() {
+			gameMap.Tracker.RecordOrder(o)
 		}
 	}
-	for coords, hex := range gameMap.MyBees { //second, order free bees
-		isActiveBlocker := (coords == gameMap.BlockerPositions[0])
-		isSaboteur := gameMap.MySaboteurs[coords]
-
-		if isActiveBlocker || isSaboteur {
-			continue
+	a.lastOut = out
+	gameMap.updateGameMap(state, player)
+	gameMap.ExpandFringe()
+	a.updateExploringStatus()
+	a.releaseLost()
+	a.roles.Sync(gameMap.Tracker)
+
+	w := &World{Agent: a, State: state, Player: player}
+	a.roles.Balance(a.wantedRoles(state, player), w)
+	if (gameMap.TargetHive != Coords{}) && len(gameMap.Tracker.WithRole(ROLE_BLOCKER)) == 0 {
+		gameMap.TargetHive = Coords{} //nobody free to send, try again next turn
+	}
+	if gameMap.IsWalling {
+		gameMap.Reserved.Hold(gameMap.WallTarget) //keep our own bees off the wall site
+	}
+	gameMap.planSpawnFaces()
+	gameMap.planEngagements(state, player)
+
+	//match the free foragers to flower fields
+	var foragers []*Bee
+	for _, bee := range gameMap.Tracker.WithRole(ROLE_FORAGER) {
+		if !bee.HasFlower {
+			foragers = append(foragers, bee)
 		}
+	}
+	a.tasks.Allocate(gameMap, foragers)
 
-		// If we are building, and this is the designated builder
-		if gameMap.IsBuilding && coords == gameMap.Builders[0] {
-			continue
+	for _, bee := range gameMap.Tracker.Bees {
+		bee.Reason, bee.Goal, bee.Path = "", bee.Pos, nil
+	}
+
+	//bees carrying flowers get the first pick of the paths home, then by role
+	for _, bee := range gameMap.Tracker.sorted() {
+		if ctx.Err() != nil {
+			return
 		}
-		if hex != nil && !hex.Entity.HasFlower {
-			if exploring && gameMap.Mapped[coords].Type == EXPLORER {
-				orders = append(orders, exploreOrder(*hex, coords, player))
-			} else {
-				orders = append(orders, beeOrder(*hex, coords, player))
+		if bee.HasFlower {
+			out.Add(a.orderFor(bee, w))
+		}
+	}
+	for _, kind := range orderPriority {
+		for _, bee := range gameMap.Tracker.WithRole(kind) {
+			if ctx.Err() != nil {
+				return
+			}
+			if !bee.HasFlower {
+				out.Add(a.orderFor(bee, w))
 			}
 		}
 	}
-	for coords, _ := range gameMap.MyHives { //see if we should spawn bees
-		if len(gameMap.MyBees) >= BeesPerHive*len(gameMap.MyHives)+gameMap.blockerCount() ||
-			int(gameMap.FlowerCount)/state.NumPlayers < 6 {
+
+	for _, coords := range sortedKeys(gameMap.MyHives) { //see if we should spawn bees
+		if len(gameMap.MyBees) >= a.Params.BeesPerHive*len(gameMap.MyHives)+gameMap.blockerCount() ||
+			int(gameMap.FlowerCount)/state.NumPlayers < a.Params.SpawnMinFlower {
 			break
 		}
 		beesNear := 0
 		for bee := range gameMap.MyBees {
-			if dist(coords, bee) < 6 {
+			if dist(coords, bee) < a.Params.SpawnRadius {
 				beesNear++
 			}
 		}
 
-		empty := beesNear < 3
+		empty := beesNear < a.Params.SpawnMinNear
 		isWorthIt := gameMap.BreakEven(coords, beesNear)
-		haveMoney := state.PlayerResources[player] >= 6
+		haveMoney := state.PlayerResources[player] >= arenaRules.SpawnCost
 
-		// PRINT THE TRUTH
-		//		fmt.Printf("[TURN %d] Hive %v Analysis:\n", state.Turn, coords)
-		//		fmt.Printf("\tBreakEven: %v\n", isWorthIt)
-		if (empty || isWorthIt) && haveMoney && !should_build_hive {
-			o := spawnBee(coords, player)
+		gameMap.trace.Of(SUB_SPAWN).Debug("spawn check", "hive", coords, "beesNear", beesNear, "breakEven", isWorthIt,
+			"money", haveMoney, "savingForHive", a.shouldBuildHive)
+		if (empty || isWorthIt) && haveMoney && !a.shouldBuildHive {
+			o := gameMap.spawnBee(coords, player)
 			if o.Type == "" {
-				// fmt.Printf("\tCRITICAL: Conditions met, but spawnBee returned empty! (Hive blocked?)\n")
+				gameMap.trace.Of(SUB_SPAWN).Warn("spawn wanted but the hive is surrounded", "hive", coords)
+			} else {
+				gameMap.trace.Of(SUB_SPAWN).Info("spawning", "hive", coords, "dir", o.Direction)
 			}
-			orders = append(orders, o)
+			out.Add(o)
 		}
 	}
-	return orders
 }
 
 func main() {
-	// flag.IntVar(&BeesPerHive, "bees", 5, "Target number of bees per hive")
-	// flag.Float64Var(&ScoreThreshold, "score", 50.0, "Score threshold for new hive")
+	loadParams := paramFlags(flag.CommandLine)
+	config := flag.String("config", "", "Strategy parameters from a .json or .yaml file (flags and HIVE_* variables override it)")
+	deadline := flag.Duration("deadline", 700*time.Millisecond, "Time budget for thinking each turn, 0 for none")
+	games := flag.Int("games", 10, "sim: number of games to play; tune: games per map and player count")
+	players := flag.Int("players", 2, "sim: players per game")
+	preset := flag.String("map", "balanced", "sim: map preset (balanced, inverted, scarce, tiny)")
+	replayDir := flag.String("replay-dir", "", "Write a replay log of every game to this directory")
+	stopTurn := flag.Uint("turn", 0, "replay: stop after this turn and print its orders; debug: start at this turn")
+	traceList := flag.String("trace", "", "Trace decisions of these subsystems: explore,forage,build,block,spawn,path,wall,defend,combat,enemy,turn or all")
+	traceFile := flag.String("trace-file", "", "Write the trace here instead of stderr")
+	traceLevel := flag.String("trace-level", "debug", "Lowest trace level written: debug, info, warn or error")
+	generations := flag.Int("generations", 20, "tune: generations to run")
+	population := flag.Int("population", 12, "tune: candidates per generation")
+	method := flag.String("method", "ga", "tune: search method, ga or random")
+	tuneMaps := flag.String("tune-maps", strings.Join(tuneMapPool, ","), "tune: map presets to play every candidate on")
+	tunePlayers := flag.String("tune-players", "2,4", "tune: player counts to play every candidate with")
+	tuneTurns := flag.Uint("tune-turns", 150, "tune: turns per sim game, 0 for the full game")
+	tuneOut := flag.String("out", "tuned.json", "tune: where to write the best parameters, as a -config file")
+	tuneReport := flag.String("report", "tune_report.txt", "tune: where to write the convergence report")
+	live := flag.String("live", "", "tune: play on the arena at this host instead of the simulator")
+	seed := flag.Int64("seed", 0, "Random seed, 0 takes one from the clock (sim: seed of the first game)")
 
 	flag.Parse()
 
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Seed: %d\n", *seed) //run again with -seed to replay the same choices
+
+	params, err := loadParams(*config)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Params: %v\n", params)
+
+	tracer, closeTrace, err := openTracer(*traceList, *traceFile, *traceLevel)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer closeTrace()
+
 	args := flag.Args()
+	if len(args) > 1 && args[0] == "replay" {
+		if err := runReplay(args[1], *stopTurn, tracer); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 1 && args[0] == "debug" {
+		if err := runDebugger(args[1], *stopTurn); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "sim" {
+		if err := runSim(*games, *players, *preset, *seed, params, tracer); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "tune" {
+		counts, err := parseInts(*tunePlayers)
+		if err == nil {
+			err = runTune(tuneConfig{
+				Method:      *method,
+				Generations: *generations,
+				Population:  *population,
+				Games:       *games,
+				Maps:        strings.Split(*tuneMaps, ","),
+				Players:     counts,
+				Turns:       *tuneTurns,
+				Live:        *live,
+				Deadline:    *deadline,
+				Seed:        *seed,
+				Baseline:    params,
+				Out:         *tuneOut,
+				Report:      *tuneReport,
+			})
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if len(args) < 3 {
-		fmt.Println("Usage: ./agent [flags] <host> <gameid> <name>")
+		fmt.Println("Usage: ./agent [flags] <host> <gameid>[,<gameid>...] <name>")
+		fmt.Println("       ./agent [-turn n] replay <log>")
+		fmt.Println("       ./agent [-turn n] debug <log>")
+		fmt.Println("       ./agent [-games n] [-players n] [-map preset] [-seed n] sim")
+		fmt.Println("       ./agent [-method ga|random] [-generations n] [-population n] [-games n] [-live host] tune")
 		os.Exit(1)
 	}
 
-	exploring = true
-	gameMap = NewGameMap()
 	host := args[0]
-	id := args[1]
+	ids := strings.Split(args[1], ",")
 	name := args[2]
 
-	Run(host, id, name, think)
+	var mu sync.Mutex
+	agents := make(map[string]*Agent)
+	newAgent := func(id string) (Strategy, *ReplayLog) {
+		a := NewAgent(*seed+int64(slices.Index(ids, id)), params)
+		fmt.Printf("Game %s: seed %d\n", id, a.Seed)
+		a.Map.trace = tracer.With("game", id)
+		mu.Lock()
+		agents[id] = a
+		mu.Unlock()
+		if *replayDir == "" {
+			return a.Think, nil
+		}
+		path := filepath.Join(*replayDir, fmt.Sprintf("%s_%s.jsonl.gz", id, time.Now().Format("20060102-150405")))
+		replay, err := NewReplayLog(path, ReplayHeader{Game: id, Seed: a.Seed, Params: &a.Params, Started: time.Now()})
+		if err != nil {
+			fmt.Printf("Game %s: no replay log: %v\n", id, err)
+			return a.Think, nil
+		}
+		fmt.Printf("Game %s: recording to %s\n", id, path)
+		return a.Think, replay
+	}
+	err = RunMany(host, ids, name, DefaultRetry(), *deadline, tracer, newAgent)
+	for id, a := range agents {
+		if a.player != 0 {
+			continue
+		}
+		filename := "map.txt"
+		if len(ids) > 1 {
+			filename = fmt.Sprintf("map_%s.txt", id)
+		}
+		a.Map.DumpToFile(filename)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+Params are the strategy's tunables. Each one has a name that is its flag
+(-bees), its key in a config file (bees) and, upper-cased with HIVE_ in front,
+its environment variable (HIVE_BEES). Later sources win: defaults, then
+-config file, then environment, then flags given on the command line.
+*/
+type Params struct {
+	BeesPerHive    int     // bees to keep per hive before spawning stops and blockers go out
+	ScoreThreshold float64 // hive site score that starts a build while still exploring
+	BuildUnknown   int     // or: build once fewer unknown hexes than this are left
+	MaxHives       int
+
+	MinDToOwn   float64 // new hive at least this far from our hives
+	MinDToEnemy float64 // closer to an enemy hive than this scales the site score down
+	WExpansion  float64 // site score bonus per hex away from our nearest hive
+	WDanger     float64 // site score is divided by 1 + this times the enemy danger there
+	ScanRadius  int     // flowers counted within this of a hive site
+
+	BreakEven      float64 // spawn when flowers per bee near the hive are above this
+	BreakEvenRange int     // flower fields further than this from the hive don't count
+	SpawnRadius    int     // bees closer than this to a hive are near it
+	SpawnMinNear   int     // always spawn when fewer bees than this are near
+	SpawnMinFlower int     // don't spawn when there are fewer flowers than this per player
+
+	WallCost   int     // extra moves a path pays to break through an enemy wall
+	PathDanger float64 // extra moves a safe path pays per enemy bee in reach, see pathcost.go
+	PathCrowd  int     // extra moves a fast path pays per bee of ours next to a hex
+
+	MaxWalls         int // most walls of ours standing at once
+	WallGain         int // a wall must make the enemy walk at least this much further
+	WallMinResources int // resources kept back before paying for a wall
+
+	DefenseRadius int     // enemy bees this close to standing next to a hive are threats
+	DefendThreat  float64 // threats weighing this much get a defender
+
+	EngageMargin float64 // fight a skirmish expected to gain at least this, in resources
+}
+
+func DefaultParams() Params {
+	return Params{
+		BeesPerHive:    5,
+		ScoreThreshold: 140,
+		BuildUnknown:   7,
+		MaxHives:       2,
+		MinDToOwn:      6,
+		MinDToEnemy:    12,
+		WExpansion:     0.10,
+		WDanger:        0.5,
+		ScanRadius:     5,
+		BreakEven:      0.5,
+		BreakEvenRange: 12,
+		SpawnRadius:    6,
+		SpawnMinNear:   3,
+		SpawnMinFlower: 6,
+		WallCost:       6,
+		PathDanger:     3,
+		PathCrowd:      1,
+
+		MaxWalls:         3,
+		WallGain:         4,
+		WallMinResources: 12,
+
+		DefenseRadius: 4,
+		DefendThreat:  0.55,
+
+		EngageMargin: 0,
+	}
+}
+
+var defaultParams = DefaultParams()
+
+type param struct {
+	name  string
+	ptr   any // *int or *float64
+	usage string
+}
+
+// table lists every tunable once, for flags, files, the environment and String
+func (p *Params) table() []param {
+	return []param{
+		{"bees", &p.BeesPerHive, "Target number of bees per hive"},
+		{"score", &p.ScoreThreshold, "Hive site score that starts a build while exploring"},
+		{"build-unknown", &p.BuildUnknown, "Build once fewer unknown hexes than this are left"},
+		{"max-hives", &p.MaxHives, "Most hives to build up to"},
+		{"hive-min-own", &p.MinDToOwn, "Least distance from a new hive to our others"},
+		{"hive-min-enemy", &p.MinDToEnemy, "Hive sites closer to an enemy than this score lower"},
+		{"hive-expansion", &p.WExpansion, "Hive site bonus per hex from our nearest hive"},
+		{"hive-danger", &p.WDanger, "How much enemy danger at a hive site lowers its score"},
+		{"hive-scan", &p.ScanRadius, "Radius flowers are counted in around a hive site"},
+		{"break-even", &p.BreakEven, "Spawn when flowers per nearby bee are above this"},
+		{"break-even-range", &p.BreakEvenRange, "Furthest flower field counted for spawning"},
+		{"spawn-radius", &p.SpawnRadius, "Bees closer than this to a hive count as near it"},
+		{"spawn-near", &p.SpawnMinNear, "Always spawn when fewer bees than this are near a hive"},
+		{"spawn-min-flowers", &p.SpawnMinFlower, "No spawning below this many known flowers per player"},
+		{"wall-cost", &p.WallCost, "Extra path cost of breaking through an enemy wall"},
+		{"path-danger", &p.PathDanger, "Extra path cost per enemy bee in reach, for flower carriers"},
+		{"path-crowd", &p.PathCrowd, "Extra path cost per bee of ours next to a hex, for blockers"},
+		{"max-walls", &p.MaxWalls, "Most walls of ours standing at once"},
+		{"wall-gain", &p.WallGain, "Least detour a wall must force on the enemy"},
+		{"wall-min-resources", &p.WallMinResources, "Resources kept back before paying for a wall"},
+		{"defense-radius", &p.DefenseRadius, "Enemy bees this far from our hives are threats"},
+		{"defend-threat", &p.DefendThreat, "Send a defender for threats weighing this much (1 is next to a hive)"},
+		{"engage-margin", &p.EngageMargin, "Fight skirmishes expected to gain at least this many resources, else retreat"},
+	}
+}
+
+func (p *Params) lookup(name string) (param, bool) {
+	for _, t := range p.table() {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return param{}, false
+}
+
+// Set changes the tunable called name
+func (p *Params) Set(name, value string) error {
+	if t, ok := p.lookup(name); ok {
+		switch ptr := t.ptr.(type) {
+		case *int:
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*ptr = v
+		case *float64:
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*ptr = v
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown parameter %q", name)
+}
+
+func (p Params) String() string {
+	var parts []string
+	for _, t := range p.table() {
+		switch ptr := t.ptr.(type) {
+		case *int:
+			parts = append(parts, fmt.Sprintf("%s=%d", t.name, *ptr))
+		case *float64:
+			parts = append(parts, fmt.Sprintf("%s=%g", t.name, *ptr))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalJSON writes the same keys a config file takes
+func (p Params) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any)
+	for _, t := range p.table() {
+		switch ptr := t.ptr.(type) {
+		case *int:
+			m[t.name] = *ptr
+		case *float64:
+			m[t.name] = *ptr
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (p *Params) UnmarshalJSON(data []byte) error {
+	var m map[string]json.Number
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for name, v := range m {
+		if err := p.Set(name, v.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register adds a flag for every tunable, defaulting to its current value
+func (p *Params) Register(fs *flag.FlagSet) {
+	for _, t := range p.table() {
+		switch ptr := t.ptr.(type) {
+		case *int:
+			fs.IntVar(ptr, t.name, *ptr, t.usage)
+		case *float64:
+			fs.Float64Var(ptr, t.name, *ptr, t.usage)
+		}
+	}
+}
+
+// LoadFile reads a .json file, or a .yaml/.yml file of flat "name: value" lines
+func (p *Params) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".json":
+		if err := json.Unmarshal(data, p); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".yaml", ".yml":
+		in := bufio.NewScanner(strings.NewReader(string(data)))
+		for n := 1; in.Scan(); n++ {
+			line, _, _ := strings.Cut(in.Text(), "#")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return fmt.Errorf("%s:%d: want name: value", path, n)
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			if err := p.Set(strings.TrimSpace(name), value); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: config must be .json, .yaml or .yml", path)
+	}
+	return nil
+}
+
+func envName(name string) string {
+	return "HIVE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadEnv takes every HIVE_<NAME> variable that is set
+func (p *Params) LoadEnv() error {
+	for _, t := range p.table() {
+		if v, ok := os.LookupEnv(envName(t.name)); ok {
+			if err := p.Set(t.name, v); err != nil {
+				return fmt.Errorf("%s: %w", envName(t.name), err)
+			}
+		}
+	}
+	return nil
+}
+
+// paramFlags registers a flag for every tunable. After fs.Parse, the func it
+// returns builds the Params: defaults, the config file and environment over
+// them, then whatever was given on the command line.
+func paramFlags(fs *flag.FlagSet) func(config string) (Params, error) {
+	given := DefaultParams()
+	given.Register(fs)
+	return func(config string) (Params, error) {
+		p := DefaultParams()
+		if config != "" {
+			if err := p.LoadFile(config); err != nil {
+				return p, err
+			}
+		}
+		if err := p.LoadEnv(); err != nil {
+			return p, err
+		}
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			if _, ok := p.lookup(f.Name); ok && err == nil {
+				err = p.Set(f.Name, f.Value.String())
+			}
+		})
+		return p, err
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+)
+
+import . "hive-arena/common"
+
+/*
+Path costs price the hexes of a path query on top of the moves it takes, so
+each query can ask for the route it cares about: flower carriers pay for
+enemy danger and go around blockers, saboteurs pay for crowds of our own
+bees and keep moving. With Walls off a path never goes through an enemy
+wall, however much shorter breaking it would be. Extras are never negative,
+so the walking distance stays a valid A* heuristic.
+*/
+
+// HexCost is what a path pays for standing on hex, on top of the move.
+// start is where the path begins, so a bee doesn't count itself.
+type HexCost func(gm *GameMap, start, hex Coords) int
+
+type PathCost struct {
+	Name  string
+	Extra HexCost // nil for none
+	Walls bool    // may break enemy walls on the way
+}
+
+var (
+	UniformCost = PathCost{Name: "uniform", Walls: true}
+	SafeCost    = PathCost{Name: "safe", Extra: dangerCost, Walls: true} //around enemies, see enemies.go
+	FastCost    = PathCost{Name: "fast", Extra: crowdCost, Walls: true}  //around our own jams
+)
+
+// NoWalls is the same cost, never breaking a wall
+func (c PathCost) NoWalls() PathCost {
+	c.Name += ",no-walls"
+	c.Walls = false
+	return c
+}
+
+func (c PathCost) extra(gm *GameMap, start, hex Coords) int {
+	if c.Extra == nil {
+		return 0
+	}
+	return c.Extra(gm, start, hex)
+}
+
+// enters is whether a path may step onto tile
+func (c PathCost) enters(tile GameMapObject) bool {
+	return tile.Type == EMPTY_HEX || (c.Walls && tile.Type == ENEMY_WALL)
+}
+
+// walkable for cooperative planning under this cost, see coopWalkable
+func (c PathCost) walkable(tile GameMapObject) bool {
+	return coopWalkable(tile) && (c.Walls || tile.Type != ENEMY_WALL)
+}
+
+// dangerCost is the enemy danger at hex, -path-danger moves for one enemy bee in reach
+func dangerCost(gm *GameMap, start, hex Coords) int {
+	return int(math.Round(gm.Enemies.DangerAt(hex) * gm.params.PathDanger))
+}
+
+// crowdCost is -path-crowd moves for each of our other bees next to hex
+func crowdCost(gm *GameMap, start, hex Coords) int {
+	crowd := 0
+	for _, dir := range dirs {
+		n := getCoords(hex, dir)
+		if _, ours := gm.MyBees[n]; ours && n != start {
+			crowd++
+		}
+	}
+	return crowd * gm.params.PathCrowd
+}
+
+// reaches is whether a path from loc to target exists under cost this turn
+func (gm *GameMap) reaches(loc, target Coords, stopNextTo bool, cost PathCost) bool {
+	_, ok := gm.goalDistances(target, stopNextTo, cost)[loc]
+	return ok
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// openMap is a rows x cols (in hexes) map of empty hexes, row r starting at column r%2
+func openMap(rows, cols int) GameMap {
+	gm := NewGameMap()
+	for r := 0; r < rows; r++ {
+		for i := 0; i < cols; i++ {
+			gm.Mapped[Coords{Row: r, Col: 2*i + r%2}] = GameMapObject{Type: EMPTY_HEX, IsWalkable: true}
+		}
+	}
+	return gm
+}
+
+func TestPathCostTiles(t *testing.T) {
+	tests := []struct {
+		tile              GameMapObjectType
+		enters, walks     bool // with walls
+		entersNo, walksNo bool // NoWalls
+	}{
+		{EMPTY_HEX, true, true, true, true},
+		{ENEMY_WALL, true, true, false, false},
+		{OWN_BEE, false, true, false, true},
+		{ROCK_HEX, false, false, false, false},
+	}
+	noWalls := UniformCost.NoWalls()
+	for _, tt := range tests {
+		tile := GameMapObject{Type: tt.tile}
+		if UniformCost.enters(tile) != tt.enters || UniformCost.walkable(tile) != tt.walks {
+			t.Errorf("%v: enters %v, walkable %v", tt.tile, UniformCost.enters(tile), UniformCost.walkable(tile))
+		}
+		if noWalls.enters(tile) != tt.entersNo || noWalls.walkable(tile) != tt.walksNo {
+			t.Errorf("%v, no walls: enters %v, walkable %v", tt.tile, noWalls.enters(tile), noWalls.walkable(tile))
+		}
+	}
+	if noWalls.Name != "uniform,no-walls" || !UniformCost.Walls {
+		t.Errorf("NoWalls changed the cost it was called on, or is named %q", noWalls.Name)
+	}
+}
+
+func TestDangerAndCrowdCost(t *testing.T) {
+	gm := openMap(3, 5)
+	hex := Coords{Row: 1, Col: 3}
+	gm.Enemies.Danger[hex] = 0.5
+	if got := dangerCost(&gm, Coords{}, hex); got != 2 { //0.5 of an enemy at 3 moves each, rounded
+		t.Errorf("danger cost %d, want 2", got)
+	}
+	if got := dangerCost(&gm, Coords{}, Coords{Row: 0, Col: 0}); got != 0 {
+		t.Errorf("danger cost %d away from enemies", got)
+	}
+
+	start := getCoords(hex, E)
+	for _, c := range []Coords{start, getCoords(hex, W), getCoords(hex, NE), getCoords(start, E)} {
+		gm.MyBees[c] = &Hex{}
+	}
+	if got := crowdCost(&gm, start, hex); got != 2*gm.params.PathCrowd { //not the bee asking, nor one two hexes away
+		t.Errorf("crowd cost %d, want %d", got, 2*gm.params.PathCrowd)
+	}
+}
+
+// TestSafeCostDetours puts a danger hotspot on the straight line: the safe
+// path goes around it and the hexes next to it, the uniform one walks through
+func TestSafeCostDetours(t *testing.T) {
+	gm := openMap(3, 6)
+	from, to, hotspot := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 10}, Coords{Row: 0, Col: 4}
+	for _, dir := range dirs {
+		gm.Enemies.Danger[getCoords(hotspot, dir)] = 0.5
+	}
+	gm.Enemies.Danger[hotspot] = 1
+
+	direct := gm.FindPath(from, to, false, UniformCost)
+	if !direct.Reachable || direct.Cost != 5 {
+		t.Fatalf("uniform path %v costs %d, want 5", direct.Steps, direct.Cost)
+	}
+	safe := gm.FindPath(from, to, false, SafeCost)
+	if !safe.Reachable || safe.Cost != 7 {
+		t.Fatalf("safe path %v costs %d, want 7 moves and no danger", safe.Steps, safe.Cost)
+	}
+	for _, c := range safe.Steps {
+		if gm.Enemies.Danger[c] > 0 && c != to {
+			t.Errorf("safe path %v goes through danger at %v", safe.Steps, c)
+		}
+	}
+}
+
+// TestNoWallsRefusesEnemyWall walls off a corridor: breaking the wall is the
+// only way through, which a NoWalls path won't take
+func TestNoWallsRefusesEnemyWall(t *testing.T) {
+	gm := openMap(1, 5)
+	from, to, wall := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 8}, Coords{Row: 0, Col: 4}
+	gm.Mapped[wall] = GameMapObject{Type: ENEMY_WALL}
+
+	broken := gm.FindPath(from, to, false, UniformCost)
+	if want := 4 + gm.params.WallCost; !broken.Reachable || broken.Cost != want || !slices.Contains(broken.Steps, wall) {
+		t.Errorf("uniform path %v costs %d, want %d through the wall", broken.Steps, broken.Cost, want)
+	}
+	if p := gm.FindPath(from, to, false, UniformCost.NoWalls()); p.Reachable {
+		t.Errorf("no-walls path %v goes through the wall", p.Steps)
+	}
+	if gm.reaches(from, to, false, SafeCost.NoWalls()) {
+		t.Error("no-walls distance field reaches past the wall")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+import . "hive-arena/common"
+
+/*
+A replay log is gzipped JSON lines: a ReplayHeader, then one ReplayTurn for
+every turn we played, holding the /game response byte for byte as the server
+sent it and the orders that went back. `replay` feeds the states to a new
+agent with the same seed to reproduce what happened.
+*/
+
+type ReplayHeader struct {
+	Game    string
+	Seed    int64
+	Params  *Params // nil in logs from before there were Params
+	Started time.Time
+}
+
+// agent is a new agent set up like the one that played the log
+func (h ReplayHeader) agent() *Agent {
+	params := DefaultParams()
+	if h.Params != nil {
+		params = *h.Params
+	}
+	return NewAgent(h.Seed, params)
+}
+
+type ReplayTurn struct {
+	Turn     uint
+	Player   int
+	Raw      string     // the /game response, as the server sent it
+	State    *GameState `json:"-"` // decoded from Raw by ReadReplay
+	Orders   []Order
+	Think    time.Duration
+	Cut      bool // the deadline or a panic cut think short, the turn can't be reproduced
+	Fallback int  // orders filled in for the bees think didn't get to
+}
+
+type ReplayLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	gz     *gzip.Writer
+	enc    *json.Encoder
+	failed bool
+}
+
+// NewReplayLog creates the log file and writes its header
+func NewReplayLog(path string, header ReplayHeader) (*ReplayLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	l := &ReplayLog{f: f, gz: gz, enc: json.NewEncoder(gz)}
+	if err := l.enc.Encode(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write adds a turn. A failing log is reported once and then left alone,
+// the game matters more than its record.
+func (l *ReplayLog) Write(t ReplayTurn) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return
+	}
+	err := l.enc.Encode(t)
+	if err == nil {
+		err = l.gz.Flush() //a crash should still leave every played turn readable
+	}
+	if err != nil {
+		fmt.Printf("Replay log %s: %v, not recording any more\n", l.f.Name(), err)
+		l.failed = true
+	}
+}
+
+func (l *ReplayLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return errors.Join(l.gz.Close(), l.f.Close())
+}
+
+// ReadReplay loads a whole log. A log cut short by a crash gives the turns before the cut.
+func ReadReplay(path string) (ReplayHeader, []ReplayTurn, error) {
+	var header ReplayHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return header, nil, err
+	}
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	if err := dec.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("%s: header: %w", path, err)
+	}
+	var turns []ReplayTurn
+	for {
+		var t ReplayTurn
+		err := dec.Decode(&t)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(t.Raw), &t.State)
+		}
+		if err != nil {
+			return header, turns, fmt.Errorf("%s: turn %d: %w", path, len(turns)+1, err)
+		}
+		turns = append(turns, t)
+	}
+	return header, turns, nil
+}
+
+// runReplay plays a log back through a new agent with the recorded seed and
+// compares its orders with the recorded ones, up to turn stop (0 for all).
+// Turns cut short are played but not compared.
+// At the end the agent's map is dumped to map_replay.txt.
+// Run with `go run . [-turn n] replay <log>`.
+func runReplay(path string, stop uint, tracer *Tracer) error {
+	header, turns, err := ReadReplay(path)
+	if err != nil && len(turns) == 0 {
+		return err
+	}
+	if err != nil {
+		fmt.Println("Warning:", err)
+	}
+	fmt.Printf("Game %s, seed %d, started %v, %d turns\n", header.Game, header.Seed, header.Started.Format(time.DateTime), len(turns))
+	if header.Params != nil {
+		fmt.Printf("Params: %v\n", *header.Params)
+	}
+
+	a := header.agent()
+	a.Map.trace = tracer.With("game", header.Game)
+	differ, cut := 0, 0
+	for _, t := range turns {
+		if stop != 0 && t.Turn > stop {
+			break
+		}
+		out := &OrderSet{}
+		start := time.Now()
+		a.Think(context.Background(), t.State, t.Player, out)
+		orders := out.Close()
+		took := time.Since(start)
+
+		was, _ := json.Marshal(t.Orders)
+		now, _ := json.Marshal(orders)
+		if t.Cut {
+			cut++
+		} else if !bytes.Equal(was, now) {
+			differ++
+			fmt.Printf("turn %d: orders differ (recorded %d in %v, now %d in %v)\n",
+				t.Turn, len(t.Orders), t.Think.Round(time.Millisecond), len(orders), took.Round(time.Millisecond))
+		}
+		if t.Turn == stop {
+			fmt.Printf("turn %d orders:\n", t.Turn)
+			for _, o := range orders {
+				fmt.Printf("  %s %v %s\n", o.Type, o.Coords, o.Direction)
+			}
+		}
+	}
+	fmt.Printf("%d turns with different orders, %d cut short not compared\n", differ, cut)
+	return a.Map.DumpToFile("map_replay.txt")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/patsastus/hive_arena_2025/arenamock"
+)
+
+import . "hive-arena/common"
+
+// recordMock plays the mock arena with a replay log and reads the log back
+func recordMock(t *testing.T, deadline time.Duration, strategy Strategy) []ReplayTurn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "game.jsonl.gz")
+	replay, err := NewReplayLog(path, ReplayHeader{Game: "check", Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := arenamock.New(scriptedStates(mockTurns), 1)
+	defer s.Close()
+	if err := Run(s.Host(), "check", "test", testRetry, deadline, strategy, replay, NoTrace()); err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, turns, err := ReadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != mockTurns {
+		t.Fatalf("%d turns in the log, played %d", len(turns), mockTurns)
+	}
+	return turns
+}
+
+func TestReplayKeepsServerBytes(t *testing.T) {
+	for i, turn := range recordMock(t, 0, forageStrategy) {
+		state := scriptedStates(mockTurns)[i]
+		state.Turn = uint(i + 1)
+		sent, _ := json.Marshal(state) //the mock answers with json.Encoder
+		if turn.Raw != string(sent)+"\n" {
+			t.Fatalf("turn %d: logged\n%q\nserver sent\n%q", turn.Turn, turn.Raw, string(sent)+"\n")
+		}
+		if turn.State == nil || turn.State.Turn != turn.Turn || turn.Fallback != 0 {
+			t.Fatalf("turn %d: read back as %+v", turn.Turn, turn)
+		}
+	}
+}
+
+func TestReplayMarksFallbackTurns(t *testing.T) {
+	turns := recordMock(t, 100*time.Millisecond, stuckStrategy(400*time.Millisecond))
+	if !turns[0].Cut || turns[0].Fallback == 0 {
+		t.Fatalf("turn %d used fallback orders %v but isn't marked", turns[0].Turn, turns[0].Orders)
+	}
+}
+
+// TestReplayMarksCutTurns has think order every bee and then overrun the
+// deadline: nothing is left to fill in, the turn is still marked cut
+func TestReplayMarksCutTurns(t *testing.T) {
+	turns := recordMock(t, 100*time.Millisecond, func(ctx context.Context, state *GameState, player int, out *OrderSet) {
+		forageStrategy(ctx, state, player, out)
+		time.Sleep(400 * time.Millisecond)
+	})
+	if !turns[0].Cut || turns[0].Fallback != 0 {
+		t.Fatalf("turn %d: cut %v with %d fallback orders, want cut with none", turns[0].Turn, turns[0].Cut, turns[0].Fallback)
+	}
+}
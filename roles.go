@@ -0,0 +1,249 @@
+package main
+
+import . "hive-arena/common"
+
+/*
+Every bee has exactly one role, kept in the RoleManager by bee ID. Each turn
+the agent decides how many bees it wants in each managed role, the manager
+recruits from (or releases back to) the foragers, and then every bee asks its
+role for an order. A new behaviour is a new Role, not another slice in GameMap.
+*/
+
+type RoleKind int
+
+const (
+	ROLE_FORAGER RoleKind = iota
+	ROLE_EXPLORER
+	ROLE_BUILDER
+	ROLE_BLOCKER  // on its way to block an enemy hive
+	ROLE_SABOTEUR // in place next to an enemy hive
+	ROLE_DEFENDER
+	ROLE_WALLER
+)
+
+func (r RoleKind) String() string {
+	return [...]string{"forager", "explorer", "builder", "blocker", "saboteur", "defender", "waller"}[r]
+}
+
+// World is everything a role can look at when deciding an order
+type World struct {
+	*Agent
+	State  *GameState
+	Player int
+}
+
+type Role interface {
+	Kind() RoleKind
+	// Pick chooses which free forager should take the role, nil for none
+	Pick(candidates []*Bee, w *World) *Bee
+	// Order is the bee's order this turn
+	Order(bee *Bee, w *World) Order
+}
+
+// managedRoles are recruited and released to match the wanted counts, in this order.
+// Saboteurs are never released: they stay until they die.
+var managedRoles = []RoleKind{ROLE_BUILDER, ROLE_WALLER, ROLE_BLOCKER, ROLE_DEFENDER, ROLE_EXPLORER}
+
+// orderPriority is who plans their path first (flower carriers go before all of these)
+var orderPriority = []RoleKind{ROLE_BUILDER, ROLE_WALLER, ROLE_BLOCKER, ROLE_SABOTEUR, ROLE_DEFENDER, ROLE_EXPLORER, ROLE_FORAGER}
+
+var roleRegistry = map[RoleKind]Role{
+	ROLE_FORAGER:  foragerRole{},
+	ROLE_EXPLORER: explorerRole{},
+	ROLE_BUILDER:  builderRole{},
+	ROLE_BLOCKER:  blockerRole{},
+	ROLE_SABOTEUR: saboteurRole{},
+	ROLE_DEFENDER: defenderRole{},
+	ROLE_WALLER:   wallerRole{},
+}
+
+type RoleManager struct {
+	roles map[int]Role // bee ID -> role, bees not in here are foragers
+}
+
+func NewRoleManager() *RoleManager {
+	return &RoleManager{roles: make(map[int]Role)}
+}
+
+func (m *RoleManager) Of(bee *Bee) Role {
+	if r, ok := m.roles[bee.ID]; ok {
+		return r
+	}
+	return roleRegistry[ROLE_FORAGER]
+}
+
+func (m *RoleManager) Assign(bee *Bee, kind RoleKind) {
+	m.roles[bee.ID] = roleRegistry[kind]
+	bee.Role = kind
+}
+
+// Sync drops the dead and makes sure every bee's Role matches the registry
+func (m *RoleManager) Sync(t *BeeTracker) {
+	for _, bee := range t.Died {
+		delete(m.roles, bee.ID)
+	}
+	for _, bee := range t.Bees {
+		bee.Role = m.Of(bee).Kind()
+	}
+}
+
+// Balance recruits free foragers into, or releases them from, the managed roles
+func (m *RoleManager) Balance(want map[RoleKind]int, w *World) {
+	t := w.Map.Tracker
+	for _, kind := range managedRoles {
+		have := t.WithRole(kind)
+		for len(have) > want[kind] {
+			m.Assign(have[len(have)-1], ROLE_FORAGER)
+			have = have[:len(have)-1]
+		}
+		for len(have) < want[kind] {
+			var free []*Bee
+			for _, bee := range t.WithRole(ROLE_FORAGER) {
+				if !bee.HasFlower {
+					free = append(free, bee)
+				}
+			}
+			bee := roleRegistry[kind].Pick(free, w)
+			if bee == nil {
+				break
+			}
+			m.Assign(bee, kind)
+			have = append(have, bee)
+		}
+	}
+}
+
+// nearestTo is the candidate closest to c
+func nearestTo(candidates []*Bee, c Coords) *Bee {
+	var closest *Bee
+	for _, bee := range candidates {
+		if closest == nil || dist(bee.Pos, c) < dist(closest.Pos, c) {
+			closest = bee
+		}
+	}
+	return closest
+}
+
+type foragerRole struct{}
+
+func (foragerRole) Kind() RoleKind                        { return ROLE_FORAGER }
+func (foragerRole) Pick(candidates []*Bee, w *World) *Bee { return nil }
+func (foragerRole) Order(bee *Bee, w *World) Order {
+	return w.beeOrder(*w.Map.MyBees[bee.Pos], bee.Pos, w.Player)
+}
+
+type explorerRole struct{}
+
+func (explorerRole) Kind() RoleKind { return ROLE_EXPLORER }
+
+// the bee furthest from our hives is the closest to the unknown
+func (explorerRole) Pick(candidates []*Bee, w *World) *Bee {
+	var best *Bee
+	maxDist := -1
+	for _, bee := range candidates {
+		d := getDistanceToNearestHive(bee.Pos, &w.Map)
+		if d > maxDist {
+			maxDist = d
+			best = bee
+		}
+	}
+	return best
+}
+func (explorerRole) Order(bee *Bee, w *World) Order {
+	return w.exploreOrder(*w.Map.MyBees[bee.Pos], bee.Pos, w.Player)
+}
+
+type builderRole struct{}
+
+func (builderRole) Kind() RoleKind { return ROLE_BUILDER }
+func (builderRole) Pick(candidates []*Bee, w *World) *Bee {
+	return nearestTo(candidates, w.Map.BuildTarget)
+}
+func (builderRole) Order(bee *Bee, w *World) Order {
+	bee.Task = w.Map.BuildTarget
+	return w.goBuild(bee)
+}
+
+// wallerRole puts up the planned wall, see walls.go
+type wallerRole struct{}
+
+func (wallerRole) Kind() RoleKind { return ROLE_WALLER }
+func (wallerRole) Pick(candidates []*Bee, w *World) *Bee {
+	return nearestTo(candidates, w.Map.WallTarget)
+}
+func (wallerRole) Order(bee *Bee, w *World) Order {
+	return w.goWall(bee)
+}
+
+type blockerRole struct{}
+
+func (blockerRole) Kind() RoleKind { return ROLE_BLOCKER }
+func (blockerRole) Pick(candidates []*Bee, w *World) *Bee {
+	bee := nearestTo(candidates, w.Map.BlockerTargets[w.Map.TargetHive])
+	if bee != nil {
+		bee.Target = w.Map.TargetHive
+		bee.Task = w.Map.BlockerTargets[w.Map.TargetHive]
+	}
+	return bee
+}
+func (blockerRole) Order(bee *Bee, w *World) Order {
+	order, arrived := w.Map.goSabotage(bee)
+	if arrived {
+		w.roles.Assign(bee, ROLE_SABOTEUR)
+	}
+	return order
+}
+
+type saboteurRole struct{}
+
+func (saboteurRole) Kind() RoleKind                        { return ROLE_SABOTEUR }
+func (saboteurRole) Pick(candidates []*Bee, w *World) *Bee { return nil }
+func (saboteurRole) Order(bee *Bee, w *World) Order {
+	w.Map.note(bee, "blocking enemy hive %v, attacking anything that comes close", bee.Target)
+	return w.Map.attackOrWait(bee.Target, bee.Pos)
+}
+
+// defenderRole goes for enemy bees near our hives, see defense.go
+type defenderRole struct{}
+
+func (defenderRole) Kind() RoleKind { return ROLE_DEFENDER }
+
+// only bees close enough to matter are sent, the rest keep foraging
+func (defenderRole) Pick(candidates []*Bee, w *World) *Bee {
+	var best *Bee
+	bestDist := 2 * w.Params.DefenseRadius
+	for _, bee := range candidates {
+		for _, t := range w.Map.seriousThreats() {
+			if d := dist(bee.Pos, t.Enemy); d < bestDist || best == nil && d == bestDist {
+				best, bestDist = bee, d
+			}
+		}
+	}
+	return best
+}
+func (defenderRole) Order(bee *Bee, w *World) Order {
+	gm := &w.Map
+	if dir, ok := gm.adjacentEnemy(bee.Pos); ok {
+		gm.note(bee, "attacking the enemy bee to the %s", dir)
+		return Order{Type: ATTACK, Coords: bee.Pos, Direction: dir}
+	}
+	t, ok := gm.claimThreat(bee)
+	if !ok {
+		gm.note(bee, "no threats left, waiting to be released")
+		return Order{}
+	}
+	bee.Task = t.Enemy
+	gm.note(bee, "going for the enemy at %v, %d from hive %v (danger %.2f)", t.Enemy, t.Dist, t.Hive, t.Danger)
+	order, _ := aStar(bee.Pos, t.Enemy, true, UniformCost, gm)
+	return order
+}
+
+// adjacentEnemy is the direction of an enemy bee next to c, if there is one
+func (gm *GameMap) adjacentEnemy(c Coords) (Direction, bool) {
+	for _, dir := range dirs {
+		if gm.Mapped[getCoords(c, dir)].Type == ENEMY_BEE {
+			return dir, true
+		}
+	}
+	return "", false
+}
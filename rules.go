@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+// arenaRules are the arena's numbers the agent plans with: what bees, hives
+// and walls cost, their hit points and the damage of an attack. Check them
+// against the server when it changes. The simulator plays by its own
+// sim.DefaultRules, which TestSimulatorPlaysArenaRules keeps equal to these.
+var arenaRules = sim.Rules{
+	MaxTurns:       300,
+	StartResources: 6,
+	SpawnCost:      6,
+	HiveCost:       12,
+	WallCost:       1,
+	BeeHp:          2,
+	HiveHp:         12,
+	WallHp:         6,
+	AttackDamage:   1,
+	BeeVision:      4,
+	HiveVision:     4,
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+// TestSimulatorPlaysArenaRules keeps simulated games to the rules the agent plans with
+func TestSimulatorPlaysArenaRules(t *testing.T) {
+	if got := sim.DefaultRules(); got != arenaRules {
+		t.Errorf("simulator rules %+v, agent plans with %+v", got, arenaRules)
+	}
+}
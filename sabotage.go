@@ -1,19 +1,7 @@
 package main
 
-import (
-	"fmt"
-)
-
 import . "hive-arena/common"
 
-func (gm *GameMap) updateBlockers(){
-	if (gm.TargetHive == Coords{}) { return } //when no target, skip
-	// If a bee exists at the location we expected to move to, update our tracking
-	if _, exists := gm.MyBees[gm.BlockerPositions[1]]; exists {
-		gm.BlockerPositions[0] = gm.BlockerPositions[1]
-	}
-}
-
 func (gm *GameMap) findFlanks(hive, blocker Coords) (Coords, Coords) {
 	var flanks []Coords
 	for _, dir := range dirs {
@@ -33,7 +21,7 @@ func (gm *GameMap) makeBlockTargets() {
 		fallBack := Coords{Row: -100, Col:-100}
 		for _, dir := range dirs {
 			target := getCoords(hive, dir)
-			fmt.Printf("checking %v ", target)
+			gm.trace.Of(SUB_BLOCK).Debug("checking blocker spot", "hive", hive, "spot", target)
 			tile := gm.Mapped[target]
 			isObstacle := !tile.IsWalkable && tile.Type != UNKNOWN
 			if isObstacle {continue}
@@ -54,10 +42,10 @@ func (gm *GameMap) makeBlockTargets() {
 		}
 		if bestTarget.Row != -100 {
 			gm.BlockerTargets[hive] = bestTarget
-			fmt.Printf("location selected %v", bestTarget)
+			gm.trace.Of(SUB_BLOCK).Debug("blocker spot selected", "hive", hive, "spot", bestTarget, "flanks", bestFlanks)
 		} else if fallBack.Row != -100 {
 			gm.BlockerTargets[hive] = fallBack
-			fmt.Printf("fallback location selected %v", fallBack)
+			gm.trace.Of(SUB_BLOCK).Debug("fallback blocker spot selected", "hive", hive, "spot", fallBack)
 		}
 	}
 }
@@ -95,18 +83,20 @@ func (gm *GameMap) blockerCount() int{
 	return sum
 }
 
-func (gm *GameMap) goSabotage(hive, target, bee Coords) Order {
-	if bee == target {
+// goSabotage moves a blocker to its spot next to the enemy hive. Once it is
+// there the hive counts as blocked and the next blocker can be sent.
+func (gm *GameMap) goSabotage(bee *Bee) (Order, bool) {
+	hive, target := bee.Target, bee.Task
+	if bee.Pos == target {
 		gm.IsBlocking[hive] = true
-		gm.MySaboteurs[bee] = true
 		if gm.TargetHive == hive { //reset targets if this is the first time this bee is in the correct place
-			fmt.Printf("[DEBUG] 🛑 BLOCKER ARRIVED at %v! Locking down hive %v.\n", bee, hive)
+			gm.trace.Of(SUB_BLOCK).Info("blocker arrived, hive locked down", beeAttr(bee), "hive", hive)
 			gm.TargetHive = Coords{}
-			clear(gm.BlockerPositions)
 		}
-		return gm.attackOrWait(hive, bee)
+		gm.note(bee, "arrived next to enemy hive %v", hive)
+		return gm.attackOrWait(hive, bee.Pos), true
 	}
-	order := aStar(bee, target, false, gm)
-	gm.BlockerPositions[1] = getCoords(bee, order.Direction)
-	return order
+	gm.note(bee, "going to %v to block enemy hive %v", target, hive)
+	order, _ := aStar(bee.Pos, target, false, FastCost, gm)
+	return order, false
 }
@@ -0,0 +1,264 @@
+package sim
+
+import (
+	"math/rand"
+	"slices"
+)
+
+import . "hive-arena/common"
+
+// Game is the full, unfogged state of one game
+type Game struct {
+	Rules      Rules
+	NumPlayers int
+	Turn       uint
+	Hexes      map[Coords]*Hex
+	Resources  []uint
+	Delivered  []int           // flowers each player has brought home
+	units      map[Coords]bool // hexes holding a bee or a hive, so nothing has to scan the whole map
+	rng        *rand.Rand
+	beeSight   []Coords
+	hiveSight  []Coords
+}
+
+// Rejected is an order the rules did not allow, and why
+type Rejected struct {
+	Player int
+	Order  Order
+	Reason string
+}
+
+// NewGame starts a game on a copy of hexes, which already hold every player's
+// starting hive and bees. The seed decides who acts first each turn.
+func NewGame(hexes map[Coords]*Hex, numPlayers int, rules Rules, seed int64) *Game {
+	g := &Game{
+		Rules:      rules,
+		NumPlayers: numPlayers,
+		Hexes:      make(map[Coords]*Hex, len(hexes)),
+		Resources:  make([]uint, numPlayers),
+		Delivered:  make([]int, numPlayers),
+		units:      make(map[Coords]bool),
+		rng:        rand.New(rand.NewSource(seed)),
+		beeSight:   disc(rules.BeeVision),
+		hiveSight:  disc(rules.HiveVision),
+	}
+	for c, hex := range hexes {
+		g.Hexes[c] = copyHex(hex)
+		if e := hex.Entity; e != nil && e.Type != WALL {
+			g.units[c] = true
+		}
+	}
+	for p := range g.Resources {
+		g.Resources[p] = rules.StartResources
+	}
+	return g
+}
+
+func copyHex(hex *Hex) *Hex {
+	cp := *hex
+	if hex.Entity != nil {
+		e := *hex.Entity
+		cp.Entity = &e
+	}
+	return &cp
+}
+
+// Alive tells which players still have a hive or a bee
+func (g *Game) Alive() []bool {
+	alive := make([]bool, g.NumPlayers)
+	for c := range g.units {
+		alive[g.Hexes[c].Entity.Player] = true
+	}
+	return alive
+}
+
+// Over is true once the turns run out or at most one player is left
+func (g *Game) Over() bool {
+	if g.Turn >= g.Rules.MaxTurns {
+		return true
+	}
+	left := 0
+	for _, a := range g.Alive() {
+		if a {
+			left++
+		}
+	}
+	return left <= 1
+}
+
+// State is what player sees this turn: the hexes in sight of its bees and hives
+func (g *Game) State(player int) *GameState {
+	state := &GameState{
+		NumPlayers:      g.NumPlayers,
+		Turn:            g.Turn,
+		Hexes:           make(map[Coords]*Hex),
+		PlayerResources: slices.Clone(g.Resources),
+		GameOver:        g.Over(),
+	}
+	for c := range g.units {
+		e := g.Hexes[c].Entity
+		if e.Player != player {
+			continue
+		}
+		sight := g.beeSight
+		if e.Type == HIVE {
+			sight = g.hiveSight
+		}
+		for _, o := range sight {
+			seen := Coords{Row: c.Row + o.Row, Col: c.Col + o.Col}
+			if _, done := state.Hexes[seen]; done {
+				continue
+			}
+			if h, ok := g.Hexes[seen]; ok {
+				state.Hexes[seen] = copyHex(h)
+			}
+		}
+	}
+	return state
+}
+
+type playerOrder struct {
+	player int
+	order  Order
+}
+
+/*
+Step plays one turn. Orders are carried out one at a time, taking one from each
+player in turn, starting from a player drawn at random; each player's orders in
+the order it sent them. A unit acts at most once per turn, and an order that
+doesn't fit the board as it is at that moment (the hex got taken, the unit died)
+is rejected.
+*/
+func (g *Game) Step(orders [][]Order) []Rejected {
+	var queue []playerOrder
+	first := g.rng.Intn(g.NumPlayers)
+	for i := 0; ; i++ {
+		added := false
+		for k := 0; k < g.NumPlayers; k++ {
+			p := (first + k) % g.NumPlayers
+			if p < len(orders) && i < len(orders[p]) {
+				queue = append(queue, playerOrder{p, orders[p][i]})
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+
+	var rejected []Rejected
+	acted := make(map[*Entity]bool)
+	for _, po := range queue {
+		if reason := g.apply(po.player, po.order, acted); reason != "" {
+			rejected = append(rejected, Rejected{po.player, po.order, reason})
+		}
+	}
+	g.Turn++
+	return rejected
+}
+
+// apply carries out one order, returning why it could not be
+func (g *Game) apply(player int, o Order, acted map[*Entity]bool) string {
+	hex := g.Hexes[o.Coords]
+	if hex == nil || hex.Entity == nil || hex.Entity.Player != player {
+		return "no unit of yours there"
+	}
+	unit := hex.Entity
+	if acted[unit] {
+		return "unit already acted"
+	}
+	if (o.Type == SPAWN) != (unit.Type == HIVE) || unit.Type == WALL {
+		return "wrong unit for order"
+	}
+
+	var to Coords
+	var target *Hex
+	if o.Type == MOVE || o.Type == ATTACK || o.Type == BUILD_WALL || o.Type == SPAWN {
+		var ok bool
+		if to, ok = step(o.Coords, o.Direction); !ok {
+			return "bad direction"
+		}
+		if target = g.Hexes[to]; target == nil {
+			return "off the map"
+		}
+	}
+
+	switch o.Type {
+	case MOVE:
+		if !target.Terrain.IsWalkable() || target.Entity != nil {
+			return "blocked"
+		}
+		target.Entity, hex.Entity = unit, nil
+		delete(g.units, o.Coords)
+		g.units[to] = true
+	case FORAGE:
+		switch {
+		case !unit.HasFlower && hex.Terrain == FIELD && hex.Resources > 0:
+			hex.Resources--
+			unit.HasFlower = true
+		case unit.HasFlower && g.nextToHive(o.Coords, player):
+			unit.HasFlower = false
+			g.Resources[player]++
+			g.Delivered[player]++
+		default:
+			return "nothing to forage"
+		}
+	case ATTACK:
+		if target.Entity == nil {
+			return "nothing to attack"
+		}
+		target.Entity.Hp -= g.Rules.AttackDamage
+		if target.Entity.Hp <= 0 {
+			target.Entity = nil
+			delete(g.units, to)
+		}
+	case BUILD_WALL:
+		if !target.Terrain.IsWalkable() || target.Entity != nil {
+			return "blocked"
+		}
+		if !g.pay(player, g.Rules.WallCost) {
+			return "not enough resources"
+		}
+		target.Entity = &Entity{Type: WALL, Hp: g.Rules.WallHp, Player: player}
+	case BUILD_HIVE:
+		if hex.Terrain != EMPTY {
+			return "can only build on empty ground"
+		}
+		if !g.pay(player, g.Rules.HiveCost) {
+			return "not enough resources"
+		}
+		hex.Entity = &Entity{Type: HIVE, Hp: g.Rules.HiveHp, Player: player}
+	case SPAWN:
+		if !target.Terrain.IsWalkable() || target.Entity != nil {
+			return "blocked"
+		}
+		if !g.pay(player, g.Rules.SpawnCost) {
+			return "not enough resources"
+		}
+		target.Entity = &Entity{Type: BEE, Hp: g.Rules.BeeHp, Player: player}
+		g.units[to] = true
+		acted[target.Entity] = true //new bees wait for next turn
+	default:
+		return "unknown order"
+	}
+	acted[unit] = true
+	return ""
+}
+
+func (g *Game) pay(player int, cost uint) bool {
+	if g.Resources[player] < cost {
+		return false
+	}
+	g.Resources[player] -= cost
+	return true
+}
+
+func (g *Game) nextToHive(c Coords, player int) bool {
+	for _, dir := range dirs {
+		n, _ := step(c, dir)
+		if h := g.Hexes[n]; h != nil && h.Entity != nil && h.Entity.Type == HIVE && h.Entity.Player == player {
+			return true
+		}
+	}
+	return false
+}
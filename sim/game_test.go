@@ -0,0 +1,273 @@
+package sim
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// board is a two player game on an empty 9x9 hex map, with terrain and units
+// put where given
+func board(terrain map[Coords]Terrain, units map[Coords]*Entity) *Game {
+	hexes := make(map[Coords]*Hex)
+	for r := 0; r < 9; r++ {
+		for i := 0; i < 9; i++ {
+			c := Coords{Row: r, Col: 2*i + r%2}
+			hexes[c] = &Hex{Terrain: EMPTY}
+		}
+	}
+	for c, t := range terrain {
+		hexes[c].Terrain = t
+		if t == FIELD {
+			hexes[c].Resources = 3
+		}
+	}
+	for c, e := range units {
+		hexes[c].Entity = e
+	}
+	return NewGame(hexes, 2, DefaultRules(), 1)
+}
+
+func bee(player int) *Entity  { return &Entity{Type: BEE, Hp: DefaultRules().BeeHp, Player: player} }
+func hive(player int) *Entity { return &Entity{Type: HIVE, Hp: DefaultRules().HiveHp, Player: player} }
+
+var (
+	at     = Coords{Row: 4, Col: 8} // the middle of the board
+	east   = Coords{Row: 4, Col: 10}
+	farE   = Coords{Row: 4, Col: 12}
+	corner = Coords{Row: 0, Col: 0}
+)
+
+// ruleCase plays orders for player 0 on a board and checks what became of it
+type ruleCase struct {
+	name     string
+	terrain  map[Coords]Terrain
+	units    map[Coords]*Entity
+	setup    func(g *Game)
+	orders   []Order
+	rejected []string // reasons, in order
+	check    func(g *Game) string
+}
+
+func (tt ruleCase) run(t *testing.T) {
+	t.Helper()
+	g := board(tt.terrain, tt.units)
+	if tt.setup != nil {
+		tt.setup(g)
+	}
+	rejected := g.Step([][]Order{tt.orders})
+	if len(rejected) != len(tt.rejected) {
+		t.Errorf("%s: rejected %v, want %v", tt.name, rejected, tt.rejected)
+		return
+	}
+	for i, r := range rejected {
+		if r.Reason != tt.rejected[i] {
+			t.Errorf("%s: rejected %v for %q, want %q", tt.name, r.Order, r.Reason, tt.rejected[i])
+		}
+	}
+	if tt.check != nil {
+		if msg := tt.check(g); msg != "" {
+			t.Errorf("%s: %s", tt.name, msg)
+		}
+	}
+}
+
+// unitAt names what stands on c, for checks
+func unitAt(g *Game, c Coords) *Entity {
+	return g.Hexes[c].Entity
+}
+
+func TestMove(t *testing.T) {
+	for _, tt := range []ruleCase{
+		{name: "onto empty ground", units: map[Coords]*Entity{at: bee(0)}, orders: []Order{{Type: MOVE, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if unitAt(g, at) != nil || unitAt(g, east) == nil || !g.units[east] || g.units[at] {
+					return "bee did not move east"
+				}
+				return ""
+			}},
+		{name: "onto a field", terrain: map[Coords]Terrain{east: FIELD}, units: map[Coords]*Entity{at: bee(0)}, orders: []Order{{Type: MOVE, Coords: at, Direction: E}}},
+		{name: "onto rock", terrain: map[Coords]Terrain{east: ROCK}, units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: MOVE, Coords: at, Direction: E}}, rejected: []string{"blocked"}},
+		{name: "onto a bee", units: map[Coords]*Entity{at: bee(0), east: bee(1)},
+			orders: []Order{{Type: MOVE, Coords: at, Direction: E}}, rejected: []string{"blocked"}},
+		{name: "off the map", units: map[Coords]*Entity{corner: bee(0)},
+			orders: []Order{{Type: MOVE, Coords: corner, Direction: NW}}, rejected: []string{"off the map"}},
+		{name: "bad direction", units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: MOVE, Coords: at, Direction: "N"}}, rejected: []string{"bad direction"}},
+		{name: "twice in a turn", units: map[Coords]*Entity{at: bee(0)},
+			orders:   []Order{{Type: MOVE, Coords: at, Direction: E}, {Type: MOVE, Coords: east, Direction: E}},
+			rejected: []string{"unit already acted"}},
+		{name: "someone else's bee", units: map[Coords]*Entity{at: bee(1)},
+			orders: []Order{{Type: MOVE, Coords: at, Direction: E}}, rejected: []string{"no unit of yours there"}},
+		{name: "a hive", units: map[Coords]*Entity{at: hive(0)},
+			orders: []Order{{Type: MOVE, Coords: at, Direction: E}}, rejected: []string{"wrong unit for order"}},
+		{name: "into a freed hex", units: map[Coords]*Entity{at: bee(0), east: bee(0)},
+			orders: []Order{{Type: MOVE, Coords: east, Direction: E}, {Type: MOVE, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if unitAt(g, farE) == nil || unitAt(g, east) == nil {
+					return "the second bee did not follow the first"
+				}
+				return ""
+			}},
+	} {
+		tt.run(t)
+	}
+}
+
+func TestAttack(t *testing.T) {
+	rules := DefaultRules()
+	carrier := bee(1)
+	carrier.HasFlower = true
+	below := Coords{Row: 5, Col: 9}
+	for _, tt := range []ruleCase{
+		{name: "a bee", units: map[Coords]*Entity{at: bee(0), east: bee(1)}, orders: []Order{{Type: ATTACK, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if e := unitAt(g, east); e == nil || e.Hp != rules.BeeHp-rules.AttackDamage {
+					return "bee not hurt by one attack"
+				}
+				return ""
+			}},
+		{name: "a carrier to death", units: map[Coords]*Entity{at: bee(0), below: bee(0), east: carrier},
+			orders: []Order{{Type: ATTACK, Coords: at, Direction: E}, {Type: ATTACK, Coords: below, Direction: NE}},
+			check: func(g *Game) string {
+				if unitAt(g, east) != nil || g.units[east] {
+					return "bee still there after two attacks"
+				}
+				if alive := g.Alive(); alive[1] {
+					return "player 1 still alive with no units"
+				}
+				return ""
+			}},
+		{name: "a hive", units: map[Coords]*Entity{at: bee(0), east: hive(1)}, orders: []Order{{Type: ATTACK, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if e := unitAt(g, east); e == nil || e.Hp != rules.HiveHp-rules.AttackDamage {
+					return "hive not hurt"
+				}
+				return ""
+			}},
+		{name: "nothing", units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: ATTACK, Coords: at, Direction: E}}, rejected: []string{"nothing to attack"}},
+	} {
+		tt.run(t)
+	}
+}
+
+func TestForage(t *testing.T) {
+	full := bee(0)
+	full.HasFlower = true
+	for _, tt := range []ruleCase{
+		{name: "pick a flower", terrain: map[Coords]Terrain{at: FIELD}, units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: FORAGE, Coords: at}},
+			check: func(g *Game) string {
+				if !unitAt(g, at).HasFlower || g.Hexes[at].Resources != 2 {
+					return "no flower picked"
+				}
+				return ""
+			}},
+		{name: "an empty field", terrain: map[Coords]Terrain{at: FIELD}, units: map[Coords]*Entity{at: bee(0)},
+			setup: func(g *Game) { g.Hexes[at].Resources = 0 }, orders: []Order{{Type: FORAGE, Coords: at}},
+			rejected: []string{"nothing to forage"}},
+		{name: "deliver", units: map[Coords]*Entity{at: full, east: hive(0)}, orders: []Order{{Type: FORAGE, Coords: at}},
+			check: func(g *Game) string {
+				if unitAt(g, at).HasFlower || g.Resources[0] != DefaultRules().StartResources+1 || g.Delivered[0] != 1 {
+					return "flower not delivered"
+				}
+				return ""
+			}},
+		{name: "deliver away from a hive", units: map[Coords]*Entity{at: full, farE: hive(0)},
+			orders: []Order{{Type: FORAGE, Coords: at}}, rejected: []string{"nothing to forage"}},
+		{name: "deliver to someone else's hive", units: map[Coords]*Entity{at: full, east: hive(1)},
+			orders: []Order{{Type: FORAGE, Coords: at}}, rejected: []string{"nothing to forage"}},
+	} {
+		tt.run(t)
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	rules := DefaultRules()
+	for _, tt := range []ruleCase{
+		{name: "a bee", units: map[Coords]*Entity{at: hive(0)}, orders: []Order{{Type: SPAWN, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if e := unitAt(g, east); e == nil || e.Type != BEE || e.Hp != rules.BeeHp || g.Resources[0] != rules.StartResources-rules.SpawnCost {
+					return "no bee spawned, or not paid for"
+				}
+				return ""
+			}},
+		{name: "a bee that moves straight away", units: map[Coords]*Entity{at: hive(0)},
+			orders:   []Order{{Type: SPAWN, Coords: at, Direction: E}, {Type: MOVE, Coords: east, Direction: E}},
+			rejected: []string{"unit already acted"}},
+		{name: "without the resources", units: map[Coords]*Entity{at: hive(0)},
+			setup:  func(g *Game) { g.Resources[0] = rules.SpawnCost - 1 },
+			orders: []Order{{Type: SPAWN, Coords: at, Direction: E}}, rejected: []string{"not enough resources"}},
+		{name: "onto a bee", units: map[Coords]*Entity{at: hive(0), east: bee(1)},
+			orders: []Order{{Type: SPAWN, Coords: at, Direction: E}}, rejected: []string{"blocked"}},
+		{name: "from a bee", units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: SPAWN, Coords: at, Direction: E}}, rejected: []string{"wrong unit for order"}},
+	} {
+		tt.run(t)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	rules := DefaultRules()
+	rich := func(g *Game) { g.Resources[0] = rules.HiveCost }
+	for _, tt := range []ruleCase{
+		{name: "a wall", units: map[Coords]*Entity{at: bee(0)}, orders: []Order{{Type: BUILD_WALL, Coords: at, Direction: E}},
+			check: func(g *Game) string {
+				if e := unitAt(g, east); e == nil || e.Type != WALL || e.Hp != rules.WallHp || e.Player != 0 || g.units[east] {
+					return "no wall of player 0"
+				}
+				if g.Resources[0] != rules.StartResources-rules.WallCost {
+					return "wall not paid for"
+				}
+				return ""
+			}},
+		{name: "a wall on rock", terrain: map[Coords]Terrain{east: ROCK}, units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: BUILD_WALL, Coords: at, Direction: E}}, rejected: []string{"blocked"}},
+		{name: "a wall without the resources", units: map[Coords]*Entity{at: bee(0)}, setup: func(g *Game) { g.Resources[0] = 0 },
+			orders: []Order{{Type: BUILD_WALL, Coords: at, Direction: E}}, rejected: []string{"not enough resources"}},
+		{name: "a hive", units: map[Coords]*Entity{at: bee(0)}, setup: rich, orders: []Order{{Type: BUILD_HIVE, Coords: at}},
+			check: func(g *Game) string {
+				if e := unitAt(g, at); e == nil || e.Type != HIVE || e.Hp != rules.HiveHp || g.Resources[0] != 0 {
+					return "the bee did not become a paid for hive"
+				}
+				return ""
+			}},
+		{name: "a hive on a field", terrain: map[Coords]Terrain{at: FIELD}, units: map[Coords]*Entity{at: bee(0)}, setup: rich,
+			orders: []Order{{Type: BUILD_HIVE, Coords: at}}, rejected: []string{"can only build on empty ground"}},
+		{name: "a hive without the resources", units: map[Coords]*Entity{at: bee(0)},
+			orders: []Order{{Type: BUILD_HIVE, Coords: at}}, rejected: []string{"not enough resources"}},
+	} {
+		tt.run(t)
+	}
+}
+
+func TestFogOfWar(t *testing.T) {
+	rules := DefaultRules()
+	ours := Coords{Row: 4, Col: 2}
+	inSight := Coords{Row: 4, Col: 2 + 2*rules.BeeVision}
+	outOfSight := Coords{Row: 4, Col: 2 + 2*(rules.BeeVision+1)}
+	g := board(nil, map[Coords]*Entity{ours: bee(0), inSight: bee(1), outOfSight: hive(1)})
+
+	state := g.State(0)
+	if state.Hexes[inSight] == nil || state.Hexes[inSight].Entity == nil {
+		t.Errorf("enemy bee %d hexes away not seen", rules.BeeVision)
+	}
+	if state.Hexes[outOfSight] != nil {
+		t.Errorf("enemy hive %d hexes away seen", rules.BeeVision+1)
+	}
+	for c := range state.Hexes {
+		if Dist(c, ours) > rules.BeeVision {
+			t.Errorf("%v seen, %d hexes away", c, Dist(c, ours))
+		}
+	}
+	if theirs := g.State(1); theirs.Hexes[ours] == nil || theirs.Hexes[outOfSight] == nil {
+		t.Error("player 1 does not see its own hive, or our bee next to its bee")
+	}
+
+	state.Hexes[ours].Entity.Hp = 0 //a copy: changing it leaves the game alone
+	if unitAt(g, ours).Hp != rules.BeeHp {
+		t.Error("state shares its hexes with the game")
+	}
+}
@@ -0,0 +1,77 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+import . "hive-arena/common"
+
+// MapConfig describes a family of random maps
+type MapConfig struct {
+	Rows, Cols  int     // in hexes
+	Rocks       float64 // share of rock hexes
+	Fields      float64 // share of flower field hexes
+	Flowers     int     // most flowers in one field
+	StartRing   float64 // how far out the starting hives sit, 0 centre to 1 edge
+	FieldsOut   bool    // fields gather at the edge instead of the middle
+	StartingBee int     // bees next to each starting hive
+}
+
+// Presets are stand-ins for the arena's map pool, by the same names
+var Presets = map[string]MapConfig{
+	"balanced": {Rows: 30, Cols: 30, Rocks: .12, Fields: .08, Flowers: 6, StartRing: .8, StartingBee: 2},
+	"inverted": {Rows: 30, Cols: 30, Rocks: .12, Fields: .08, Flowers: 6, StartRing: .3, FieldsOut: true, StartingBee: 2},
+	"scarce":   {Rows: 30, Cols: 30, Rocks: .15, Fields: .03, Flowers: 4, StartRing: .8, StartingBee: 2},
+	"tiny":     {Rows: 14, Cols: 14, Rocks: .10, Fields: .10, Flowers: 5, StartRing: .7, StartingBee: 2},
+}
+
+// Generate lays out a map for numPlayers from cfg, starting hives evenly
+// spaced around a ring with the ground around them cleared
+func Generate(cfg MapConfig, numPlayers int, rules Rules, seed int64) map[Coords]*Hex {
+	rng := rand.New(rand.NewSource(seed))
+	hexes := make(map[Coords]*Hex)
+	centre := Coords{Row: cfg.Rows / 2, Col: cfg.Cols + (cfg.Rows/2)%2}
+	radius := float64(min(cfg.Rows, cfg.Cols)) / 2
+	for r := 0; r < cfg.Rows; r++ {
+		for i := 0; i < cfg.Cols; i++ {
+			c := Coords{Row: r, Col: 2*i + r%2}
+			out := min(float64(Dist(c, centre))/radius, 1) //0 in the middle, 1 at the edge
+			fieldOdds := cfg.Fields * 2 * (1 - out)
+			if cfg.FieldsOut {
+				fieldOdds = cfg.Fields * 2 * out
+			}
+			hex := &Hex{Terrain: EMPTY}
+			switch roll := rng.Float64(); {
+			case roll < cfg.Rocks:
+				hex.Terrain = ROCK
+			case roll < cfg.Rocks+fieldOdds:
+				hex.Terrain = FIELD
+				hex.Resources = uint(1 + rng.Intn(cfg.Flowers))
+			}
+			hexes[c] = hex
+		}
+	}
+
+	turn := rng.Float64() * 2 * math.Pi
+	for p := 0; p < numPlayers; p++ {
+		angle := turn + 2*math.Pi*float64(p)/float64(numPlayers)
+		row := centre.Row + int(math.Round(math.Sin(angle)*cfg.StartRing*(radius-2)))
+		col := centre.Col + int(math.Round(2*math.Cos(angle)*cfg.StartRing*(radius-2)))
+		if (row+col)%2 != 0 {
+			col++
+		}
+		start := Coords{Row: row, Col: col}
+		for _, o := range disc(2) {
+			if h, ok := hexes[Coords{Row: row + o.Row, Col: col + o.Col}]; ok {
+				*h = Hex{Terrain: EMPTY}
+			}
+		}
+		hexes[start].Entity = &Entity{Type: HIVE, Hp: rules.HiveHp, Player: p}
+		for _, dir := range dirs[:min(cfg.StartingBee, len(dirs))] {
+			c, _ := step(start, dir)
+			hexes[c].Entity = &Entity{Type: BEE, Hp: rules.BeeHp, Player: p}
+		}
+	}
+	return hexes
+}
@@ -0,0 +1,52 @@
+package sim
+
+import . "hive-arena/common"
+
+// Player decides the orders for one turn from what it can see
+type Player func(state *GameState, player int) []Order
+
+// Result is how a finished game went
+type Result struct {
+	Turns     uint
+	Delivered []int  // flowers brought home by each player
+	Alive     []bool // who still had a bee or hive at the end
+	Rejected  []int  // orders each player had refused
+}
+
+// Winner is the player who brought home most flowers, -1 on a tie
+func (r Result) Winner() int {
+	best, winner := -1, -1
+	for p, d := range r.Delivered {
+		switch {
+		case d > best:
+			best, winner = d, p
+		case d == best:
+			winner = -1
+		}
+	}
+	return winner
+}
+
+// Play runs g to the end with one Player per seat. The players are called one
+// after the other, so they don't have to be safe to run at the same time.
+func Play(g *Game, players []Player) Result {
+	res := Result{Rejected: make([]int, g.NumPlayers)}
+	orders := make([][]Order, g.NumPlayers)
+	alive := g.Alive()
+	for !g.Over() {
+		for p, play := range players {
+			orders[p] = nil
+			if alive[p] {
+				orders[p] = play(g.State(p), p)
+			}
+		}
+		for _, r := range g.Step(orders) {
+			res.Rejected[r.Player]++
+		}
+		alive = g.Alive()
+	}
+	res.Turns = g.Turn
+	res.Delivered = append([]int(nil), g.Delivered...)
+	res.Alive = alive
+	return res
+}
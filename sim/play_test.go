@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// idle never gives an order
+func idle(state *GameState, player int) []Order {
+	return nil
+}
+
+// forager is about the simplest player that keeps the rules busy: bees
+// forage where they can and wander otherwise, hives spawn when they can pay
+func forager(seed int64) Player {
+	rng := rand.New(rand.NewSource(seed))
+	return func(state *GameState, player int) []Order {
+		var orders []Order
+		for c, hex := range state.Hexes {
+			e := hex.Entity
+			if e == nil || e.Player != player {
+				continue
+			}
+			switch {
+			case e.Type == HIVE:
+				orders = append(orders, Order{Type: SPAWN, Coords: c, Direction: dirs[rng.Intn(len(dirs))]})
+			case e.Type == BEE && (e.HasFlower || hex.Resources > 0):
+				orders = append(orders, Order{Type: FORAGE, Coords: c})
+			case e.Type == BEE:
+				orders = append(orders, Order{Type: MOVE, Coords: c, Direction: dirs[rng.Intn(len(dirs))]})
+			}
+		}
+		return orders
+	}
+}
+
+// BenchmarkPlay times whole games on the balanced preset with trivial players,
+// so what is measured is the simulator and not a strategy. One op is one game.
+func BenchmarkPlay(b *testing.B) {
+	for _, bench := range []struct {
+		name    string
+		players func(n int, seed int64) []Player
+	}{
+		{"idle", func(n int, seed int64) []Player {
+			players := make([]Player, n)
+			for p := range players {
+				players[p] = idle
+			}
+			return players
+		}},
+		{"forager", func(n int, seed int64) []Player {
+			players := make([]Player, n)
+			for p := range players {
+				players[p] = forager(seed + int64(p))
+			}
+			return players
+		}},
+	} {
+		for _, n := range []int{2, 4} {
+			b.Run(fmt.Sprintf("%s/%dp", bench.name, n), func(b *testing.B) {
+				rules := DefaultRules()
+				for i := 0; i < b.N; i++ {
+					seed := int64(i)
+					g := NewGame(Generate(Presets["balanced"], n, rules, seed), n, rules, seed)
+					Play(g, bench.players(n, seed))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package sim plays hive arena games locally, without the server: it applies
+// the orders of every player with the arena's rules and hands each player the
+// part of the map its units can see.
+package sim
+
+import . "hive-arena/common"
+
+// Rules are the numbers the game is played with. DefaultRules is our reading
+// of the arena's; check them against the server when it changes, and vary them
+// to see how sensitive a strategy is to them.
+type Rules struct {
+	MaxTurns       uint
+	StartResources uint
+	SpawnCost      uint // a new bee
+	HiveCost       uint // turning a bee into a hive
+	WallCost       uint
+	BeeHp          int
+	HiveHp         int
+	WallHp         int
+	AttackDamage   int
+	BeeVision      int // how far a bee sees
+	HiveVision     int
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		MaxTurns:       300,
+		StartResources: 6,
+		SpawnCost:      6,
+		HiveCost:       12,
+		WallCost:       1,
+		BeeHp:          2,
+		HiveHp:         12,
+		WallHp:         6,
+		AttackDamage:   1,
+		BeeVision:      4,
+		HiveVision:     4,
+	}
+}
+
+var dirs = []Direction{E, SE, SW, W, NW, NE}
+
+// Dist is the number of moves between two hexes in doubled coordinates
+func Dist(a, b Coords) int {
+	dr := a.Row - b.Row
+	if dr < 0 {
+		dr = -dr
+	}
+	dc := a.Col - b.Col
+	if dc < 0 {
+		dc = -dc
+	}
+	if dc < dr {
+		return dr
+	}
+	return dr + (dc-dr)/2
+}
+
+func step(c Coords, dir Direction) (Coords, bool) {
+	offset, ok := DirectionToOffset[dir]
+	if !ok {
+		return c, false
+	}
+	return Coords{Row: c.Row + offset.Row, Col: c.Col + offset.Col}, true
+}
+
+// disc lists the offsets of every hex within radius, for vision
+func disc(radius int) []Coords {
+	var offsets []Coords
+	for dr := -radius; dr <= radius; dr++ {
+		for dc := -2 * radius; dc <= 2*radius; dc++ {
+			o := Coords{Row: dr, Col: dc}
+			if (dr+dc)%2 == 0 && Dist(o, Coords{}) <= radius {
+				offsets = append(offsets, o)
+			}
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+// simPlayer plays a fresh Agent in the simulator, thinking without a deadline
+func simPlayer(seed int64, params Params, trace *Tracer) sim.Player {
+	a := NewAgent(seed, params)
+	a.Map.trace = trace
+	return func(state *GameState, player int) []Order {
+		out := &OrderSet{}
+		a.Think(context.Background(), state, player, out)
+		return out.Close()
+	}
+}
+
+// runSim plays games of the agent against copies of itself on generated
+// maps and prints how they went. Run with `go run . sim`.
+func runSim(games, players int, preset string, seed int64, params Params, tracer *Tracer) error {
+	cfg, ok := sim.Presets[preset]
+	if !ok {
+		return fmt.Errorf("unknown map preset %q", preset)
+	}
+	rules := sim.DefaultRules()
+	wins := make([]int, players)
+	start := time.Now()
+	for i := 0; i < games; i++ {
+		s := seed + int64(i)
+		g := sim.NewGame(sim.Generate(cfg, players, rules, s), players, rules, s)
+		seats := make([]sim.Player, players)
+		for p := range seats {
+			seats[p] = simPlayer(s+int64(p), params, tracer.With("game", i, "seat", p))
+		}
+		res := sim.Play(g, seats)
+		if w := res.Winner(); w >= 0 {
+			wins[w]++
+		}
+		fmt.Printf("game %d (seed %d): %d turns, delivered %v, alive %v, rejected %v\n",
+			i, s, res.Turns, res.Delivered, res.Alive, res.Rejected)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("%d games on %s in %v (%.0f/min), wins by seat %v\n",
+		games, preset, elapsed.Round(time.Millisecond), float64(games)/elapsed.Minutes(), wins)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+// playRecorded plays a short simulated game from seed and returns every
+// order each player gave, encoded, turn by turn
+func playRecorded(seed int64) [][][]byte {
+	rules := sim.DefaultRules()
+	rules.MaxTurns = 80
+	g := sim.NewGame(sim.Generate(sim.Presets["tiny"], 2, rules, seed), 2, rules, seed)
+	played := make([][][]byte, 2)
+	players := make([]sim.Player, 2)
+	for p := range players {
+		play := simPlayer(seed+int64(p), DefaultParams(), NoTrace())
+		players[p] = func(state *GameState, player int) []Order {
+			orders := play(state, player)
+			raw, _ := json.Marshal(orders)
+			played[player] = append(played[player], raw)
+			return orders
+		}
+	}
+	sim.Play(g, players)
+	return played
+}
+
+// TestSeedReplaysGame plays the same seed twice: every turn's orders must be byte-identical
+func TestSeedReplaysGame(t *testing.T) {
+	const seed = 7
+	first, second := playRecorded(seed), playRecorded(seed)
+	for p := range first {
+		if len(first[p]) != len(second[p]) {
+			t.Fatalf("player %d played %d turns, then %d", p, len(first[p]), len(second[p]))
+		}
+		for turn := range first[p] {
+			if !bytes.Equal(first[p][turn], second[p][turn]) {
+				t.Fatalf("player %d, turn %d: orders differ on replay:\n%s\n%s", p, turn+1, first[p][turn], second[p][turn])
+			}
+		}
+	}
+}
@@ -1,9 +1,5 @@
 package main
 
-import (
-// "fmt"
-)
-
 import . "hive-arena/common"
 
 // distance-weighted sum of flowers near location
@@ -34,22 +30,11 @@ func (gm *GameMap) hiveScore(coords Coords, radius int) float64 {
 	return sum
 }
 
-func (gm *GameMap) updateBuilderLoc() {
-	if _, exists := gm.MyBees[gm.Builders[1]]; exists { //assign a boolean to 'exists'; then use it. If true, builder bee is in expected position
-		gm.Builders[0] = gm.Builders[1] //update the position of the builder
-	}
-}
-
 // returns the coordinates of the best hive position and a score of how many flowers are nearby
 func (gm *GameMap) bestNewHivePos() (Coords, float64) {
 	bestScore := 0.0
 	bestLocation := Coords{}
-	const ( //tunable constants
-		minDToOwn   = 6.0
-		minDToEnemy = 12.0
-		wExpansion  = 0.10
-		scanRadius  = 5
-	)
+	p := gm.params
 	for field, object := range gm.Mapped {
 		if object == (GameMapObject{}) || !object.IsWalkable || object.Type == ENEMY_HIVE || object.Type == OWN_HIVE {
 			continue
@@ -58,7 +43,7 @@ func (gm *GameMap) bestNewHivePos() (Coords, float64) {
 		for hive, _ := range gm.MyHives {
 			closestHiveD = min(closestHiveD, dist(hive, field))
 		}
-		if closestHiveD < minDToOwn {
+		if float64(closestHiveD) < p.MinDToOwn {
 			continue
 		}
 		closestEnemyD := 20000
@@ -68,40 +53,39 @@ func (gm *GameMap) bestNewHivePos() (Coords, float64) {
 				closestEnemyD = d
 			}
 		}
-		rawScore := gm.hiveScore(field, scanRadius)
+		rawScore := gm.hiveScore(field, p.ScanRadius)
 		if rawScore < 0.1 {
 			continue
 		}
 
 		safetyFactor := 1.0
-		if float64(closestEnemyD) < minDToEnemy {
-			safetyFactor = float64(closestEnemyD) / minDToEnemy
+		if float64(closestEnemyD) < p.MinDToEnemy {
+			safetyFactor = float64(closestEnemyD) / p.MinDToEnemy
 		}
 
-		expansionFactor := 1.0 + (float64(closestHiveD) * wExpansion)
-		finalScore := rawScore * safetyFactor * expansionFactor
+		expansionFactor := 1.0 + (float64(closestHiveD) * p.WExpansion)
+		dangerFactor := 1.0 / (1.0 + gm.Enemies.DangerAt(field)*p.WDanger)
+		finalScore := rawScore * safetyFactor * expansionFactor * dangerFactor
 
-		if finalScore > bestScore {
+		if finalScore > bestScore || (finalScore == bestScore && compareCoords(field, bestLocation) < 0) {
 			bestScore = finalScore
 			bestLocation = field
 		}
 	}
-	// fmt.Printf("Best hive location: %v, score: %f\n", bestLocation, bestScore)
+	gm.trace.Of(SUB_BUILD).Debug("best hive site", "site", bestLocation, "score", bestScore)
 	return bestLocation, bestScore
 }
 
 // used to calculate flowers-per-turn and turns-until-depleted
 func (gm *GameMap) effectiveDistance() float64 {
 	weightedSum := 0.0
-	for field, nonEmpty := range gm.FlowerFields {
+	for _, field := range sortedKeys(gm.FlowerFields) { //sum in order, float sums depend on it
 		distance := 20000
-		if !nonEmpty {
+		if !gm.FlowerFields[field] {
 			continue
 		}
-		for hive, _ := range gm.MyHives {
-			if dist(field, hive) < distance {
-				distance = dist(field, hive)
-			}
+		if _, d, ok := gm.NearestHive(field); ok { //walk, then the step onto the hive
+			distance = d + 1
 		}
 		weightedSum += float64(gm.Mapped[field].Flowers) / float64(distance)
 	}
@@ -119,9 +103,9 @@ func (gm *GameMap) estimateFlowersPerTurn(beeCount int) float64 {
 	return float64(beeCount) / (2.0*d + 2.0) //+2 is for picking up and dropping off flower
 }
 
-// assumes opponents have the same flowerrate as us
+// assumes opponents have the same flowerrate as us, and as many bees as the enemy model guesses
 func (gm *GameMap) turnsUntilDepleted() int {
-	ratio := float64(len(gm.MyBees)+gm.EnemyBees) / float64(len(gm.MyBees))
+	ratio := float64(len(gm.MyBees)+gm.Enemies.Total()) / float64(len(gm.MyBees))
 	FPT := gm.estimateFlowersPerTurn(len(gm.MyBees))
 	if FPT < 0.001 {
 		return 0
@@ -142,15 +126,16 @@ func (gm *GameMap) BreakEven(hive Coords) bool {
 
 func (gm *GameMap) BreakEven(hive Coords, beesNear int) bool {
 	localPotential := 0.0
-	for field, isField := range gm.FlowerFields {
-		if !isField {
+	for _, field := range sortedKeys(gm.FlowerFields) {
+		if !gm.FlowerFields[field] {
 			continue
 		}
-		d := dist(hive, field)
-		if d == 0 {
-			d = 1
+		d, ok := gm.HiveDistance(hive, field)
+		if !ok {
+			continue
 		}
-		if d <= 12 {
+		d++ //walk, then the step onto the hive
+		if d <= gm.params.BreakEvenRange {
 			localPotential += float64(gm.Mapped[field].Flowers) / float64(d)
 		}
 	}
@@ -159,23 +144,23 @@ func (gm *GameMap) BreakEven(hive Coords, beesNear int) bool {
 	}
 	score := localPotential / float64(beesNear)
 
-	// DEBUG
-	// fmt.Printf("Hive %v Score: %.2f (Pot: %.1f / Bees: %.1f)\n", hive, score, localPotential, beesNear)
+	gm.trace.Of(SUB_SPAWN).Debug("break even", "hive", hive, "score", score, "potential", localPotential, "beesNear", beesNear)
 
 	// Tune this number! Start low (0.5) and raise it if you overspawn.
-	return score > 0.5
+	return score > gm.params.BreakEven
 }
 
-func (gm *GameMap) goBuild() Order {
-	if gm.Builders[0] != gm.BuildTarget {
-		temp := aStar(gm.Builders[0], gm.BuildTarget, false, gm)
-		gm.Builders[1] = getCoords(gm.Builders[0], temp.Direction)
+func (a *Agent) goBuild(builder *Bee) Order {
+	gm := &a.Map
+	if builder.Pos != gm.BuildTarget {
+		gm.note(builder, "going to build a hive at %v", gm.BuildTarget)
+		temp, _ := aStar(builder.Pos, gm.BuildTarget, false, UniformCost, gm)
 		return temp
 	}
+	gm.note(builder, "building a hive here")
 	gm.IsBuilding = false
-	HasExplorer = false
 	return (Order{
 		Type:   BUILD_HIVE,
-		Coords: gm.Builders[0],
+		Coords: builder.Pos,
 	})
 }
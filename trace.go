@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+/*
+Decision tracing: every subsystem logs through the GameMap's Tracer, which
+drops everything from subsystems that aren't switched on. Turn it on with
+-trace explore,block (or all), at -trace-level, into -trace-file.
+*/
+
+type Subsystem string
+
+const (
+	SUB_EXPLORE Subsystem = "explore"
+	SUB_FORAGE  Subsystem = "forage"
+	SUB_BUILD   Subsystem = "build"
+	SUB_BLOCK   Subsystem = "block"
+	SUB_SPAWN   Subsystem = "spawn"
+	SUB_PATH    Subsystem = "path"
+	SUB_WALL    Subsystem = "wall"
+	SUB_DEFEND  Subsystem = "defend"
+	SUB_COMBAT  Subsystem = "combat"
+	SUB_ENEMY   Subsystem = "enemy"
+	SUB_TURN    Subsystem = "turn" // the client's think deadline, see deadline.go
+)
+
+var subsystems = []Subsystem{SUB_EXPLORE, SUB_FORAGE, SUB_BUILD, SUB_BLOCK, SUB_SPAWN, SUB_PATH, SUB_WALL, SUB_DEFEND, SUB_COMBAT, SUB_ENEMY, SUB_TURN}
+
+var discard = slog.New(slog.DiscardHandler)
+
+type Tracer struct {
+	Turn uint // added to every record
+	base *slog.Logger
+	on   map[Subsystem]*slog.Logger
+}
+
+// NoTrace logs nothing
+func NoTrace() *Tracer {
+	return &Tracer{base: discard, on: make(map[Subsystem]*slog.Logger)}
+}
+
+// NewTracer logs the listed subsystems ("all" for every one) to w as text,
+// from level up
+func NewTracer(w io.Writer, level slog.Level, list string) (*Tracer, error) {
+	t := NoTrace()
+	t.base = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, sub := range subsystems {
+				t.on[sub] = nil
+			}
+		default:
+			sub := Subsystem(name)
+			if _, known := subsystemIndex(sub); !known {
+				return nil, fmt.Errorf("unknown trace subsystem %q, want one of %v or all", name, subsystems)
+			}
+			t.on[sub] = nil
+		}
+	}
+	for sub := range t.on {
+		t.on[sub] = t.base.With("sys", string(sub))
+	}
+	return t, nil
+}
+
+func subsystemIndex(sub Subsystem) (int, bool) {
+	for i, s := range subsystems {
+		if s == sub {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// With is a Tracer that adds args to every record, e.g. the game id
+func (t *Tracer) With(args ...any) *Tracer {
+	w := &Tracer{Turn: t.Turn, base: t.base.With(args...), on: make(map[Subsystem]*slog.Logger)}
+	for sub, l := range t.on {
+		w.on[sub] = l.With(args...)
+	}
+	return w
+}
+
+// Of is the logger for a subsystem, one that drops everything if it is off
+func (t *Tracer) Of(sub Subsystem) *slog.Logger {
+	if l, ok := t.on[sub]; ok {
+		return l.With("turn", t.Turn)
+	}
+	return discard
+}
+
+// Enabled tells whether a record would be written, to skip working out expensive fields
+func (t *Tracer) Enabled(sub Subsystem, level slog.Level) bool {
+	l, ok := t.on[sub]
+	return ok && l.Enabled(context.Background(), level)
+}
+
+// beeAttr is the context every record about a bee carries
+func beeAttr(bee *Bee) slog.Attr {
+	if bee == nil {
+		return slog.Group("bee")
+	}
+	return slog.Group("bee", "id", bee.ID, "pos", bee.Pos, "role", bee.Role.String())
+}
+
+// roleSubsystem is where decisions for a bee with this role are traced
+func roleSubsystem(role RoleKind) Subsystem {
+	switch role {
+	case ROLE_EXPLORER:
+		return SUB_EXPLORE
+	case ROLE_BUILDER:
+		return SUB_BUILD
+	case ROLE_WALLER:
+		return SUB_WALL
+	case ROLE_BLOCKER, ROLE_SABOTEUR:
+		return SUB_BLOCK
+	case ROLE_DEFENDER:
+		return SUB_DEFEND
+	}
+	return SUB_FORAGE
+}
+
+// openTracer builds the Tracer the flags ask for, and a func to close its file
+func openTracer(list, path, level string) (*Tracer, func(), error) {
+	if list == "" {
+		return NoTrace(), func() {}, nil
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, nil, fmt.Errorf("trace level: %w", err)
+	}
+	w, closeFile := io.Writer(os.Stderr), func() {}
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closeFile = f, func() { f.Close() }
+	}
+	t, err := NewTracer(w, lvl, list)
+	if err != nil {
+		closeFile()
+		return nil, nil, err
+	}
+	return t, closeFile, nil
+}
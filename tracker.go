@@ -0,0 +1,166 @@
+package main
+
+import (
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+The server only tells us where our bees are, not which is which. The tracker
+matches last turn's bees to this turn's using the orders we gave them, so every
+bee keeps an ID, a role and a task for as long as it lives.
+*/
+
+const historyLength = 16
+
+type Bee struct {
+	ID        int
+	Pos       Coords
+	HasFlower bool
+	Role      RoleKind
+	Task      Coords   // where its role is taking it
+	Target    Coords   // what the task is about, e.g. the enemy hive a blocker blocks
+	History   []Coords // last positions, oldest first, Pos not included
+	Born      uint     // turn we first saw it
+	Reason    string   // why it got this turn's order, only kept for the debugger and the trace
+	Goal      Coords   // where this turn's order heads
+	Path      []Coords // the steps planned for it this turn, Pos first
+
+	expected Coords // where its order for this turn should take it
+}
+
+type BeeTracker struct {
+	Bees     map[int]*Bee
+	At       map[Coords]*Bee
+	Spawned  []*Bee          // new this turn
+	Died     []*Bee          // gone since last turn
+	Attacked map[Coords]int  // hits our orders aimed at each hex last turn
+	attacks  map[Coords]int  // this turn's, Attacked after the next Update
+	spawns   map[Coords]bool // hexes this turn's SPAWN orders fill
+	nextID   int
+}
+
+func NewBeeTracker() *BeeTracker {
+	return &BeeTracker{
+		Bees:     make(map[int]*Bee),
+		At:       make(map[Coords]*Bee),
+		Attacked: make(map[Coords]int),
+		attacks:  make(map[Coords]int),
+		spawns:   make(map[Coords]bool),
+		nextID:   1,
+	}
+}
+
+// Update matches this turn's bees with last turn's: first where their order
+// should have taken them, then where they were (the move failed), then any
+// neighbour we didn't spawn a bee onto. Whatever is left over has died or was
+// just spawned.
+func (t *BeeTracker) Update(myBees map[Coords]*Hex, turn uint) {
+	t.Spawned = t.Spawned[:0]
+	t.Died = t.Died[:0]
+	t.Attacked, t.attacks = t.attacks, t.Attacked
+	clear(t.attacks)
+	previous := t.sorted()
+	clear(t.At)
+
+	matched := make(map[int]bool)
+	claim := func(b *Bee, pos Coords) bool {
+		if _, mine := myBees[pos]; !mine || t.At[pos] != nil {
+			return false
+		}
+		if pos != b.Pos {
+			b.History = append(b.History, b.Pos)
+			if len(b.History) > historyLength {
+				b.History = b.History[1:]
+			}
+		}
+		b.Pos = pos
+		t.At[pos] = b
+		matched[b.ID] = true
+		return true
+	}
+	for _, b := range previous {
+		claim(b, b.expected)
+	}
+	for _, b := range previous {
+		if !matched[b.ID] {
+			claim(b, b.Pos)
+		}
+	}
+	for _, b := range previous {
+		for _, dir := range dirs {
+			n := getCoords(b.Pos, dir)
+			if matched[b.ID] || !t.spawns[n] && claim(b, n) { //a bee dying next to a hive must not take the new one's place
+				break
+			}
+		}
+	}
+	clear(t.spawns)
+	for _, b := range previous {
+		if !matched[b.ID] {
+			delete(t.Bees, b.ID)
+			t.Died = append(t.Died, b)
+		}
+	}
+
+	var fresh []Coords
+	for pos := range myBees {
+		if t.At[pos] == nil {
+			fresh = append(fresh, pos)
+		}
+	}
+	slices.SortFunc(fresh, compareCoords)
+	for _, pos := range fresh {
+		b := &Bee{ID: t.nextID, Pos: pos, Born: turn}
+		t.nextID++
+		t.Bees[b.ID] = b
+		t.At[pos] = b
+		t.Spawned = append(t.Spawned, b)
+	}
+
+	for pos, hex := range myBees {
+		b := t.At[pos]
+		b.HasFlower = hex.Entity != nil && hex.Entity.HasFlower
+		b.expected = pos
+	}
+}
+
+// RecordOrder remembers where the order should take the bee, what it
+// attacks and where it spawns one, for the next Update
+func (t *BeeTracker) RecordOrder(o Order) {
+	switch o.Type {
+	case ATTACK:
+		t.attacks[getCoords(o.Coords, o.Direction)]++
+	case SPAWN:
+		t.spawns[getCoords(o.Coords, o.Direction)] = true
+	}
+	b := t.At[o.Coords]
+	if b == nil {
+		return
+	}
+	if o.Type == MOVE {
+		b.expected = getCoords(o.Coords, o.Direction)
+	}
+}
+
+// sorted returns the bees in ID order, so decisions don't depend on map order
+func (t *BeeTracker) sorted() []*Bee {
+	bees := make([]*Bee, 0, len(t.Bees))
+	for _, b := range t.Bees {
+		bees = append(bees, b)
+	}
+	slices.SortFunc(bees, func(a, b *Bee) int { return a.ID - b.ID })
+	return bees
+}
+
+// WithRole lists the living bees with the role, in ID order
+func (t *BeeTracker) WithRole(role RoleKind) []*Bee {
+	var bees []*Bee
+	for _, b := range t.sorted() {
+		if b.Role == role {
+			bees = append(bees, b)
+		}
+	}
+	return bees
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+)
+
+import . "hive-arena/common"
+
+// beesAt is our bees for an Update, one at each of cs
+func beesAt(cs ...Coords) map[Coords]*Hex {
+	bees := map[Coords]*Hex{}
+	for _, c := range cs {
+		bees[c] = &Hex{Terrain: EMPTY, Entity: &Entity{Type: BEE, Hp: 2, Player: 0}}
+	}
+	return bees
+}
+
+func TestTrackerFollowsBees(t *testing.T) {
+	a, b := Coords{Row: 0, Col: 0}, Coords{Row: 2, Col: 0}
+	tests := []struct {
+		name  string
+		order Order
+		then  Coords
+	}{
+		{"moved as ordered", Order{Type: MOVE, Coords: a, Direction: E}, getCoords(a, E)},
+		{"move failed", Order{Type: MOVE, Coords: a, Direction: E}, a},
+		{"moved elsewhere", Order{Type: MOVE, Coords: a, Direction: E}, getCoords(a, SE)},
+		{"foraged", Order{Type: FORAGE, Coords: a}, a},
+	}
+	for _, tt := range tests {
+		tr := NewBeeTracker()
+		tr.Update(beesAt(a, b), 1)
+		id, other := tr.At[a].ID, tr.At[b].ID
+		tr.At[a].Role = ROLE_DEFENDER
+		tr.RecordOrder(tt.order)
+		tr.Update(beesAt(tt.then, b), 2)
+		bee := tr.At[tt.then]
+		if bee == nil || bee.ID != id || bee.Role != ROLE_DEFENDER || tr.At[b].ID != other {
+			t.Errorf("%s: %+v at %v, want bee %d", tt.name, bee, tt.then, id)
+		}
+		if len(tr.Died)+len(tr.Spawned) != 0 {
+			t.Errorf("%s: %d died, %d spawned", tt.name, len(tr.Died), len(tr.Spawned))
+		}
+	}
+}
+
+// TestTrackerSpawnBesideDeath kills a bee on one face of our hive while we
+// spawn onto the face next to it: the new bee doesn't take the dead one's place
+func TestTrackerSpawnBesideDeath(t *testing.T) {
+	hive := Coords{Row: 0, Col: 0}
+	dying, face := getCoords(hive, E), getCoords(hive, SE)
+	tr := NewBeeTracker()
+	tr.Update(beesAt(dying), 1)
+	dead := tr.At[dying]
+	dead.Role, dead.Task = ROLE_SABOTEUR, Coords{Row: 10, Col: 10}
+
+	tr.RecordOrder(Order{Type: SPAWN, Coords: hive, Direction: SE})
+	tr.Update(beesAt(face), 2)
+	if len(tr.Died) != 1 || tr.Died[0] != dead {
+		t.Errorf("died %v, want bee %d", tr.Died, dead.ID)
+	}
+	born := tr.At[face]
+	if len(tr.Spawned) != 1 || tr.Spawned[0] != born || born.ID == dead.ID || born.Role == ROLE_SABOTEUR || born.Task != (Coords{}) || born.Born != 2 {
+		t.Errorf("spawned %+v, want a new bee with no role or task of its own", born)
+	}
+
+	tr.Update(beesAt(getCoords(face, E)), 3) //the spawn is only kept for one turn
+	if len(tr.Spawned) != 0 || tr.At[getCoords(face, E)] != born {
+		t.Errorf("bee %d stepping off the face was not followed", born.ID)
+	}
+}
+
+func TestTrackerAttacks(t *testing.T) {
+	a := Coords{Row: 0, Col: 0}
+	tr := NewBeeTracker()
+	tr.Update(beesAt(a), 1)
+	tr.RecordOrder(Order{Type: ATTACK, Coords: a, Direction: W})
+	tr.RecordOrder(Order{Type: ATTACK, Coords: a, Direction: W})
+	tr.Update(beesAt(a), 2)
+	if hits := tr.Attacked[getCoords(a, W)]; hits != 2 || len(tr.Attacked) != 1 {
+		t.Errorf("attacked %v, want 2 hits west", tr.Attacked)
+	}
+	tr.Update(beesAt(a), 3)
+	if len(tr.Attacked) != 0 {
+		t.Errorf("attacked %v a turn with no attacks", tr.Attacked)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+/*
+The tuner searches Params for values that beat a baseline. Every candidate
+plays the same set of matches (each map in the pool, each player count, a few
+seeds, its seat rotated) against copies of the baseline, and scores by where
+it finished and its share of the flowers. The search is a genetic algorithm
+(or plain random search), the best candidate so far is written as a -config
+file and every generation goes into a convergence report.
+*/
+
+type tuneRange struct{ lo, hi float64 }
+
+// tuneRanges bounds the search, by parameter name
+var tuneRanges = map[string]tuneRange{
+	"bees":               {2, 12},
+	"score":              {40, 300},
+	"build-unknown":      {0, 30},
+	"max-hives":          {1, 4},
+	"hive-min-own":       {3, 12},
+	"hive-min-enemy":     {4, 20},
+	"hive-expansion":     {0, 0.5},
+	"hive-danger":        {0, 3},
+	"hive-scan":          {2, 8},
+	"break-even":         {0.1, 2},
+	"break-even-range":   {4, 20},
+	"spawn-radius":       {3, 10},
+	"spawn-near":         {1, 6},
+	"spawn-min-flowers":  {0, 15},
+	"wall-cost":          {1, 15},
+	"path-danger":        {0, 10},
+	"path-crowd":         {0, 4},
+	"max-walls":          {0, 8},
+	"wall-gain":          {1, 12},
+	"wall-min-resources": {0, 40},
+	"defense-radius":     {1, 8},
+	"defend-threat":      {0.2, 1},
+	"engage-margin":      {-6, 6},
+}
+
+// tuneMapPool is dev_match's MapPool, as simulator presets
+var tuneMapPool = []string{"balanced", "inverted", "scarce", "tiny"}
+
+type tuneConfig struct {
+	Method      string // "ga" or "random"
+	Generations int
+	Population  int
+	Games       int // per map and player count
+	Maps        []string
+	Players     []int
+	Turns       uint          // sim game length
+	Live        string        // arena host to play on instead of the simulator
+	Deadline    time.Duration // think time per turn in live games, the agent's -deadline
+	Seed        int64
+	Baseline    Params
+	Out         string // best Params, as a -config file
+	Report      string
+}
+
+func paramValue(t param) float64 {
+	switch ptr := t.ptr.(type) {
+	case *int:
+		return float64(*ptr)
+	case *float64:
+		return *ptr
+	}
+	return 0
+}
+
+func setParamValue(t param, v float64) {
+	r, ok := tuneRanges[t.name]
+	if ok {
+		v = max(r.lo, min(v, r.hi))
+	}
+	switch ptr := t.ptr.(type) {
+	case *int:
+		*ptr = int(math.Round(v))
+	case *float64:
+		*ptr = math.Round(v*1000) / 1000
+	}
+}
+
+func randomParams(rng *rand.Rand, base Params) Params {
+	p := base
+	for _, t := range p.table() {
+		if r, ok := tuneRanges[t.name]; ok {
+			setParamValue(t, r.lo+rng.Float64()*(r.hi-r.lo))
+		}
+	}
+	return p
+}
+
+// crossover takes each parameter from a or b at random
+func crossover(rng *rand.Rand, a, b Params) Params {
+	child := a
+	from := b.table()
+	for i, t := range child.table() {
+		if rng.Intn(2) == 0 {
+			setParamValue(t, paramValue(from[i]))
+		}
+	}
+	return child
+}
+
+// mutate nudges each parameter with probability rate, by up to about a sixth of its range
+func mutate(rng *rand.Rand, p Params, rate float64) Params {
+	for _, t := range p.table() {
+		r, ok := tuneRanges[t.name]
+		if ok && rng.Float64() < rate {
+			setParamValue(t, paramValue(t)+rng.NormFloat64()*(r.hi-r.lo)/6)
+		}
+	}
+	return p
+}
+
+// tuneMatch is one game: the candidate sits in Seat, the baseline everywhere else
+type tuneMatch struct {
+	Map     string
+	Players int
+	Seed    int64
+	Seat    int
+}
+
+// matchScore is how the candidate did: 1 for first, 0 for last, plus its share
+// of the flowers. Alone in a game it is first.
+func matchScore(flowers []int, seat int) float64 {
+	total, beaten := 0, 0
+	for p, f := range flowers {
+		total += f
+		if p != seat && flowers[seat] > f {
+			beaten++
+		}
+	}
+	score := 1.0
+	if len(flowers) > 1 {
+		score = float64(beaten) / float64(len(flowers)-1)
+	}
+	if total > 0 {
+		score += float64(flowers[seat]) / float64(total)
+	}
+	return score
+}
+
+// playSim plays a match in the simulator and returns each seat's flowers
+func playSim(cfg *tuneConfig, m tuneMatch, seats []Params) ([]int, error) {
+	preset, ok := sim.Presets[m.Map]
+	if !ok {
+		return nil, fmt.Errorf("unknown map preset %q", m.Map)
+	}
+	rules := sim.DefaultRules()
+	if cfg.Turns > 0 {
+		rules.MaxTurns = cfg.Turns
+	}
+	g := sim.NewGame(sim.Generate(preset, m.Players, rules, m.Seed), m.Players, rules, m.Seed)
+	players := make([]sim.Player, m.Players)
+	for p := range players {
+		players[p] = simPlayer(m.Seed+int64(p), seats[p], NoTrace())
+	}
+	return sim.Play(g, players).Delivered, nil
+}
+
+// delivered counts the flowers player brought home between two states it saw:
+// its bees that stood next to its hive with a flower and are still there without one
+func delivered(before, after *GameState, player int) int {
+	n := 0
+	for c, hex := range before.Hexes {
+		bee := hex.Entity
+		if bee == nil || bee.Type != BEE || bee.Player != player || !bee.HasFlower || !nextToOwnHive(before, c, player) {
+			continue
+		}
+		if now, ok := after.Hexes[c]; ok && now.Entity != nil && now.Entity.Type == BEE && now.Entity.Player == player && !now.Entity.HasFlower {
+			n++
+		}
+	}
+	return n
+}
+
+// playLive creates a game on the arena at host and plays every seat from
+// this process. Like in the simulator, flowers are what each player brought
+// home, counted by its seat from the states it was sent (the last turn's
+// deliveries are not seen).
+func playLive(cfg *tuneConfig, m tuneMatch, seats []Params) ([]int, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	url := fmt.Sprintf("http://%s/newgame?map=%s&players=%d", cfg.Live, m.Map, m.Players)
+	// a retried /newgame would leave a game nobody joins
+	if _, err := requestJSON(url, &created, DefaultRetry(), notSent); err != nil {
+		return nil, err
+	}
+
+	flowers := make([]int, m.Players) //by seat, each written by its own goroutine only
+	errs := make([]error, m.Players)
+	var wg sync.WaitGroup
+	for p := range seats {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := NewAgent(m.Seed+int64(p), seats[p])
+			var last *GameState
+			strategy := func(ctx context.Context, state *GameState, player int, out *OrderSet) {
+				if last != nil {
+					flowers[p] += delivered(last, state, player)
+				}
+				last = state
+				a.Think(ctx, state, player, out)
+			}
+			errs[p] = Run(cfg.Live, created.ID, fmt.Sprintf("tune-%d", p), DefaultRetry(), cfg.Deadline, strategy, nil, NoTrace())
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return flowers, nil
+}
+
+// matches is the match set: every map, player count, game and seat. It is the
+// same for every generation, so fitness compares across generations.
+func (cfg *tuneConfig) matches() []tuneMatch {
+	var list []tuneMatch
+	for _, name := range cfg.Maps {
+		for _, players := range cfg.Players {
+			for i := 0; i < cfg.Games; i++ {
+				list = append(list, tuneMatch{
+					Map:     name,
+					Players: players,
+					Seed:    cfg.Seed + int64(len(list)),
+					Seat:    i % players,
+				})
+			}
+		}
+	}
+	return list
+}
+
+// evaluate scores every candidate on the same matches, several games at a time
+func (cfg *tuneConfig) evaluate(candidates []Params) ([]float64, error) {
+	play := playSim
+	workers := runtime.NumCPU()
+	if cfg.Live != "" {
+		play, workers = playLive, 1
+	}
+	matches := cfg.matches()
+	type job struct{ cand, match int }
+	jobs := make(chan job)
+	scores := make([][]float64, len(candidates))
+	for i := range scores {
+		scores[i] = make([]float64, len(matches))
+	}
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				m := matches[j.match]
+				seats := make([]Params, m.Players)
+				for p := range seats {
+					seats[p] = cfg.Baseline
+				}
+				seats[m.Seat] = candidates[j.cand]
+				flowers, err := play(cfg, m, seats)
+				if err != nil {
+					mu.Lock()
+					firstErr = cmp.Or(firstErr, err)
+					mu.Unlock()
+					continue
+				}
+				scores[j.cand][j.match] = matchScore(flowers, m.Seat)
+			}
+		}()
+	}
+	for c := range candidates {
+		for m := range matches {
+			jobs <- job{c, m}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	fitness := make([]float64, len(candidates))
+	for c, s := range scores {
+		for _, v := range s {
+			fitness[c] += v
+		}
+		fitness[c] /= float64(len(s))
+	}
+	return fitness, firstErr
+}
+
+// tournament picks the fitter of two random candidates
+func tournament(rng *rand.Rand, pop []Params, fitness []float64) Params {
+	a, b := rng.Intn(len(pop)), rng.Intn(len(pop))
+	if fitness[b] > fitness[a] {
+		a = b
+	}
+	return pop[a]
+}
+
+// runTune searches the Params space and writes the best candidate and a report.
+// Run with `go run . tune`, see tuneConfig for the knobs.
+func runTune(cfg tuneConfig) error {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	report := io.Writer(os.Stdout)
+	if cfg.Report != "" {
+		f, err := os.Create(cfg.Report)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		report = io.MultiWriter(os.Stdout, f)
+	}
+	fmt.Fprintf(report, "# tuning with %s: %d generations of %d, %d games per map and player count, maps %v, players %v, baseline %v\n",
+		cfg.Method, cfg.Generations, cfg.Population, cfg.Games, cfg.Maps, cfg.Players, cfg.Baseline)
+	fmt.Fprintf(report, "# gen  best    mean    best-ever  seconds  params of best-ever\n")
+
+	pop := make([]Params, cfg.Population)
+	pop[0] = cfg.Baseline //the baseline against itself is the score to beat
+	for i := 1; i < len(pop); i++ {
+		pop[i] = randomParams(rng, cfg.Baseline)
+	}
+	best, bestFit := cfg.Baseline, math.Inf(-1)
+	for gen := 0; gen < cfg.Generations; gen++ {
+		start := time.Now()
+		fitness, err := cfg.evaluate(pop)
+		if err != nil {
+			return fmt.Errorf("generation %d: %w", gen, err)
+		}
+		top, mean := 0, 0.0
+		for i, f := range fitness {
+			mean += f
+			if f > fitness[top] {
+				top = i
+			}
+		}
+		mean /= float64(len(fitness))
+		if fitness[top] > bestFit {
+			best, bestFit = pop[top], fitness[top]
+			if err := writeParams(cfg.Out, best); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(report, "%5d  %.4f  %.4f  %.4f     %7.1f  %v\n",
+			gen, fitness[top], mean, bestFit, time.Since(start).Seconds(), best)
+
+		next := []Params{pop[top]} //elitism: the generation's best goes on as it is
+		for len(next) < len(pop) {
+			if cfg.Method == "random" {
+				next = append(next, randomParams(rng, cfg.Baseline))
+				continue
+			}
+			child := crossover(rng, tournament(rng, pop, fitness), tournament(rng, pop, fitness))
+			next = append(next, mutate(rng, child, 0.3))
+		}
+		pop = next
+	}
+	fmt.Printf("best %.4f with %v, written to %s\n", bestFit, best, cfg.Out)
+	return nil
+}
+
+func writeParams(path string, p Params) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// parseInts reads a comma-separated list like "2,4"
+func parseInts(list string) ([]int, error) {
+	var out []int
+	for _, s := range strings.Split(list, ",") {
+		var n int
+		if _, err := fmt.Sscan(strings.TrimSpace(s), &n); err != nil {
+			return nil, fmt.Errorf("bad number %q in %q", s, list)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/patsastus/hive_arena_2025/arenamock"
+)
+
+import . "hive-arena/common"
+
+// TestDelivered counts deliveries between two states of player 0, hive at 0,2
+func TestDelivered(t *testing.T) {
+	hive := Coords{Row: 0, Col: 2}
+	beside, away := Coords{Row: 0, Col: 0}, Coords{Row: 0, Col: 6}
+	state := func(bees map[Coords]*Entity) *GameState {
+		s := &GameState{NumPlayers: 2, Hexes: map[Coords]*Hex{
+			hive:   {Terrain: EMPTY, Entity: &Entity{Type: HIVE, Hp: 12, Player: 0}},
+			beside: {Terrain: EMPTY},
+			away:   {Terrain: EMPTY},
+		}}
+		for c, bee := range bees {
+			s.Hexes[c].Entity = bee
+		}
+		return s
+	}
+	bee := func(player int, flower bool) *Entity {
+		return &Entity{Type: BEE, Hp: 2, Player: player, HasFlower: flower}
+	}
+
+	tests := []struct {
+		name          string
+		before, after map[Coords]*Entity
+		want          int
+	}{
+		{"dropped at the hive", map[Coords]*Entity{beside: bee(0, true)}, map[Coords]*Entity{beside: bee(0, false)}, 1},
+		{"still carrying", map[Coords]*Entity{beside: bee(0, true)}, map[Coords]*Entity{beside: bee(0, true)}, 0},
+		{"killed", map[Coords]*Entity{beside: bee(0, true)}, nil, 0},
+		{"away from the hive", map[Coords]*Entity{away: bee(0, true)}, map[Coords]*Entity{away: bee(0, false)}, 0},
+		{"enemy bee", map[Coords]*Entity{beside: bee(1, true)}, map[Coords]*Entity{beside: bee(1, false)}, 0},
+		{"replaced by an enemy", map[Coords]*Entity{beside: bee(0, true)}, map[Coords]*Entity{beside: bee(1, false)}, 0},
+	}
+	for _, tt := range tests {
+		if got := delivered(state(tt.before), state(tt.after), 0); got != tt.want {
+			t.Errorf("%s: delivered %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		flowers []int
+		seat    int
+		want    float64
+	}{
+		{[]int{6, 2}, 0, 1 + 0.75},
+		{[]int{6, 2}, 1, 0.25},
+		{[]int{3, 3}, 0, 0.5},
+		{[]int{0, 0, 0, 0}, 2, 0},
+		{[]int{1, 4, 2, 1}, 2, 2.0/3 + 0.25},
+		{[]int{5}, 0, 2},
+		{[]int{0}, 0, 1},
+	}
+	for _, tt := range tests {
+		got := matchScore(tt.flowers, tt.seat)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("matchScore(%v, %d) = %v, want %v", tt.flowers, tt.seat, got, tt.want)
+		}
+	}
+}
+
+// TestPlayLive plays a match on the mock arena, its bee bringing home a
+// flower every other turn
+func TestPlayLive(t *testing.T) {
+	states := scriptedStates(mockTurns)
+	for i := range states {
+		states[i].Hexes[Coords{Row: 0, Col: 0}].Entity.HasFlower = i%2 == 0
+	}
+	s := arenamock.New(states, 1)
+	defer s.Close()
+
+	cfg := &tuneConfig{Live: s.Host(), Deadline: 100 * time.Millisecond}
+	flowers, err := playLive(cfg, tuneMatch{Map: "tiny", Players: 1}, []Params{DefaultParams()})
+	if err != nil {
+		t.Fatalf("playLive: %v", err)
+	}
+	if want := (mockTurns - 1) / 2; len(flowers) != 1 || flowers[0] != want {
+		t.Errorf("flowers %v, want [%d]", flowers, want)
+	}
+	if n := s.Requests("/newgame"); n != 1 {
+		t.Errorf("%d games created", n)
+	}
+	if subs := s.Submissions(); len(subs) != mockTurns {
+		t.Errorf("%d submissions for %d turns", len(subs), mockTurns)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	. "hive-arena/common"
+	"math/rand"
 	"os"
 )
 
@@ -17,8 +18,6 @@ var directionToOffset = map[Direction]Coords{
 	SE: {1, 1},
 }
 
-var Unknown_count int
-
 const (
 	UNKNOWN GameMapObjectType = iota
 	OWN_BEE
@@ -44,45 +43,68 @@ type GameMapObject struct {
 }
 
 type GameMap struct {
-	Revealed         map[Coords]Hex
-	MyBees           map[Coords]*Hex
-	MySaboteurs      map[Coords]bool
-	MyHives          map[Coords]bool
-	EnemyHives       map[Coords]bool
-	FlowerFields     map[Coords]bool
-	Mapped           map[Coords]GameMapObject
-	Targeted         map[Coords]bool
-	Explorers        []Coords
-	StillUnexplored  bool
-	EnemyBees        int
-	FlowerCount      uint
-	Builders         []Coords
-	IsBuilding       bool
-	BuildTarget      Coords
-	IsBlocking       map[Coords]bool
-	BlockerTargets   map[Coords]Coords //map of enemy hive coordinates to blocker target coordinates
-	BlockerPositions []Coords
-	TargetHive       Coords
+	Revealed        map[Coords]Hex
+	MyBees          map[Coords]*Hex
+	Tracker         *BeeTracker //who is who among MyBees
+	MyHives         map[Coords]bool
+	MyWalls         map[Coords]bool
+	EnemyHives      map[Coords]bool
+	FlowerFields    map[Coords]bool
+	Mapped          map[Coords]GameMapObject
+	Reserved        *Reservations //hexes our bees will be on in the next turns
+	StillUnexplored bool
+	EnemyBees       int         //in sight this turn
+	Enemies         *EnemyModel //what we remember of the enemy bees, see enemies.go
+	FlowerCount     uint
+	IsBuilding      bool
+	BuildTarget     Coords
+	IsWalling       bool
+	WallTarget      Coords
+	IsBlocking      map[Coords]bool
+	BlockerTargets  map[Coords]Coords //map of enemy hive coordinates to blocker target coordinates
+	TargetHive      Coords
+	Threats         []Threat // enemy bees near our hives this turn, see defense.go
+
+	threatClaims map[Coords]bool    // threats a defender already goes for this turn
+	faceClearers map[int]Coords     // bee ID -> the hive it makes room at this turn
+	engagements  map[int]Engagement // bee ID -> what it does in its skirmish this turn
+	scratch      *pathScratch       // reused by aStar
+	fields       distanceFields
+	rng          *rand.Rand // every random choice goes through here, so a seed replays a game
+	trace        *Tracer
+	explaining   bool    // keep every bee's Reason, for the debugger
+	params       *Params // the agent's
 }
 
 func NewGameMap() GameMap {
 	return GameMap{
-		Revealed:         make(map[Coords]Hex),
-		MyBees:           make(map[Coords]*Hex),
-		MyHives:          make(map[Coords]bool),
-		EnemyHives:       make(map[Coords]bool),
-		FlowerFields:     make(map[Coords]bool),
-		Targeted:         make(map[Coords]bool),
-		Mapped:           make(map[Coords]GameMapObject),
-		Explorers:        make([]Coords, 2),
-		Builders:         make([]Coords, 2),
-		BlockerTargets:   make(map[Coords]Coords),
-		IsBlocking:       make(map[Coords]bool),
-		BlockerPositions: make([]Coords, 2),
-		MySaboteurs:      make(map[Coords]bool),
+		Revealed:       make(map[Coords]Hex),
+		MyBees:         make(map[Coords]*Hex),
+		MyHives:        make(map[Coords]bool),
+		MyWalls:        make(map[Coords]bool),
+		EnemyHives:     make(map[Coords]bool),
+		FlowerFields:   make(map[Coords]bool),
+		Reserved:       NewReservations(DefaultHorizon),
+		Mapped:         make(map[Coords]GameMapObject),
+		BlockerTargets: make(map[Coords]Coords),
+		IsBlocking:     make(map[Coords]bool),
+		Tracker:        NewBeeTracker(),
+		Enemies:        NewEnemyModel(),
+		threatClaims:   make(map[Coords]bool),
+		faceClearers:   make(map[int]Coords),
+		engagements:    make(map[int]Engagement),
+		scratch:        newPathScratch(),
+		fields:         newDistanceFields(),
+		rng:            rand.New(rand.NewSource(1)),
+		trace:          NoTrace(),
+		params:         &defaultParams,
 	}
 }
 
+func (gm *GameMap) randomDir() Direction {
+	return dirs[gm.rng.Intn(len(dirs))]
+}
+
 func addCoords(pos, offset Coords) Coords {
 	return Coords{
 		Row: pos.Row + offset.Row,
@@ -98,7 +120,7 @@ func (gm *GameMap) MarkAsEdge(c Coords) {
 			tile.IsFlowerField = false
 			tile.BeeHasFlower = false
 			tile.Flowers = 0
-			gm.Mapped[c] = tile
+			gm.setTile(c, tile)
 		}
 	}
 }
@@ -129,15 +151,20 @@ func (gm *GameMap) ExpandFringe() {
 
 			if !exists {
 				// Add the fringe tile
-				gm.Mapped[neighbor] = GameMapObject{
+				gm.setTile(neighbor, GameMapObject{
 					Type: UNKNOWN,
-				}
+				})
 			}
 		}
 	}
 }
 
+// getDistanceToNearestHive is the walk to the nearest own hive, or the straight
+// line distance when there is no known way there
 func getDistanceToNearestHive(c Coords, gm *GameMap) int {
+	if _, d, ok := gm.NearestHive(c); ok {
+		return d + 1
+	}
 	shortest := 10000
 	for hiveCoords := range gm.MyHives {
 		d := dist(c, hiveCoords)
@@ -148,21 +175,19 @@ func getDistanceToNearestHive(c Coords, gm *GameMap) int {
 	return shortest
 }
 
-func (gm *GameMap) updateExploringStatus() {
-	// fmt.Println("MY BEE COUNT: ", len(gm.MyBees))
-	// fmt.Println("EXPLORING: ", exploring)
+func (a *Agent) updateExploringStatus() {
 	// Set exploring status based on number of unknown tiles
-	if exploring {
-		Unknown_count = 0
-		for _, tile := range gm.Mapped {
+	if a.exploring {
+		a.unknownCount = 0
+		for _, tile := range a.Map.Mapped {
 			if tile.Type == UNKNOWN {
-				Unknown_count++
+				a.unknownCount++
 			}
 		}
-		if Unknown_count == 0 {
-			exploring = false
+		if a.unknownCount == 0 {
+			a.exploring = false
 		}
-		// fmt.Println("UNKNOWN COUNT: ", Unknown_count)
+		a.Map.trace.Of(SUB_EXPLORE).Debug("exploring", "unknown", a.unknownCount, "bees", len(a.Map.MyBees), "still", a.exploring)
 	}
 	// Assign an explorer role to the bee furthest from a hive not carrying a flower if there are more than 2 bees
 }
@@ -178,7 +203,7 @@ func (gm *GameMap) scanForEdges(viewer Coords, state *GameState) {
 					tile := gm.Mapped[nextPos]
 					if tile.Type != EDGE {
 						tile.Type = EDGE
-						gm.Mapped[nextPos] = tile
+						gm.setTile(nextPos, tile)
 					}
 				}
 				break
@@ -190,9 +215,8 @@ func (gm *GameMap) scanForEdges(viewer Coords, state *GameState) {
 }
 
 func (gm *GameMap) updateGameMap(state *GameState, player int) {
-	clear(gm.MyBees)   //remove all old bees from map
-	gm.EnemyBees = 0   //forget old bees
-	clear(gm.Targeted) //remove all targeted tiles from last turn
+	clear(gm.MyBees) //remove all old bees from map
+	gm.EnemyBees = 0 //forget old bees
 	for coords, visibleHex := range state.Hexes {
 		gm.Revealed[coords] = *visibleHex
 		index := 0
@@ -202,6 +226,7 @@ func (gm *GameMap) updateGameMap(state *GameState, player int) {
 		tile.IsFlowerField = false
 		tile.Flowers = 0
 		wasEdge := (tile.Type == EDGE)
+		delete(gm.MyWalls, coords)
 		unit := visibleHex.Entity
 		if unit != nil && unit.Type == HIVE {
 			if unit.Player == player {
@@ -228,6 +253,7 @@ func (gm *GameMap) updateGameMap(state *GameState, player int) {
 			}
 		} else if unit != nil && unit.Type == WALL {
 			if unit.Player == player {
+				gm.MyWalls[coords] = true
 				tile.Type = OWN_WALL
 				tile.Player = unit.Player
 			} else {
@@ -256,7 +282,7 @@ func (gm *GameMap) updateGameMap(state *GameState, player int) {
 			gm.FlowerFields[coords] = false
 		}
 		tile.IsWalkable = visibleHex.Terrain.IsWalkable()
-		gm.Mapped[coords] = tile
+		gm.setTile(coords, tile)
 	}
 	for coords, visibleHex := range state.Hexes {
 		unit := visibleHex.Entity
@@ -270,6 +296,9 @@ func (gm *GameMap) updateGameMap(state *GameState, player int) {
 			gm.FlowerCount += gm.Mapped[coords].Flowers
 		}
 	}
+	gm.Tracker.Update(gm.MyBees, state.Turn)
+	gm.updateEnemies(state, player)
+	gm.Reserved.Reset(gm.MyBees) //forget last turn's plans
 }
 
 func ClearScreen() {
@@ -278,6 +307,54 @@ func ClearScreen() {
 	fmt.Print("\033[2J\033[H")
 }
 
+// symbolAt is how DumpToFile (and the debugger) draw a hex, two characters wide
+func (gm *GameMap) symbolAt(c Coords) string {
+	tile, exists := gm.Mapped[c]
+	if !exists {
+		return "  "
+	}
+	switch tile.Type {
+	case EDGE:
+		return "# "
+	case OWN_BEE:
+		if bee := gm.Tracker.At[c]; bee != nil && bee.Role == ROLE_EXPLORER {
+			return "O "
+		}
+		return "B "
+	case ENEMY_BEE:
+		return "E "
+	case OWN_HIVE:
+		return "H "
+	case ENEMY_HIVE:
+		return "X "
+	case ROCK_HEX:
+		return "R "
+	case OWN_WALL:
+		return "W "
+	case ENEMY_WALL:
+		return "w "
+	case EMPTY_HEX:
+		if tile.IsFlowerField {
+			return "F "
+		}
+		return ". "
+	case EXPLORER:
+		return "O "
+	}
+	return "? "
+}
+
+// mapBounds is the smallest and largest row and column in Mapped
+func (gm *GameMap) mapBounds() (minR, maxR, minC, maxC int) {
+	minR, maxR = 1000, -1000
+	minC, maxC = 1000, -1000
+	for c := range gm.Mapped {
+		minR, maxR = min(minR, c.Row), max(maxR, c.Row)
+		minC, maxC = min(minC, c.Col), max(maxC, c.Col)
+	}
+	return
+}
+
 func (gm *GameMap) DumpToFile(filename string) error {
 	ClearScreen()
 	f, err := os.Create(filename)
@@ -287,23 +364,7 @@ func (gm *GameMap) DumpToFile(filename string) error {
 	defer f.Close()
 
 	// 1. Calculate Bounds
-	minR, maxR := 1000, -1000
-	minC, maxC := 1000, -1000
-
-	for c := range gm.Mapped {
-		if c.Row < minR {
-			minR = c.Row
-		}
-		if c.Row > maxR {
-			maxR = c.Row
-		}
-		if c.Col < minC {
-			minC = c.Col
-		}
-		if c.Col > maxC {
-			maxC = c.Col
-		}
-	}
+	minR, maxR, minC, maxC := gm.mapBounds()
 
 	// fmt.Fprintf(f, "Map Bounds: [%d, %d] to [%d, %d]\n", minR, minC, maxR, maxC)
 
@@ -316,39 +377,7 @@ func (gm *GameMap) DumpToFile(filename string) error {
 		// 3. Iterate Columns
 		for c := minC; c <= maxC; c++ {
 
-			tile, exists := gm.Mapped[Coords{Row: r, Col: c}]
-
-			// DEFAULT: Two standard spaces (ASCII 32)
-			symbol := "  "
-
-			if exists {
-				switch tile.Type {
-				case EDGE:
-					symbol = "# "
-				case OWN_BEE:
-					symbol = "B "
-				case ENEMY_BEE:
-					symbol = "E "
-				case OWN_HIVE:
-					symbol = "H "
-				case ENEMY_HIVE:
-					symbol = "X "
-				case ROCK_HEX:
-					symbol = "R "
-				case EMPTY_HEX:
-					if tile.IsFlowerField {
-						symbol = "F "
-					} else {
-						symbol = ". "
-					}
-				case UNKNOWN:
-					symbol = "? "
-				case EXPLORER:
-					symbol = "O "
-				default:
-					symbol = "? "
-				}
-			}
+			symbol := gm.symbolAt(Coords{Row: r, Col: c})
 			// fmt.Print(symbol)
 			fmt.Fprint(f, symbol)
 		}
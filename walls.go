@@ -0,0 +1,216 @@
+package main
+
+import (
+	"slices"
+)
+
+import . "hive-arena/common"
+
+/*
+Walls go on chokepoints between the enemy and our flower fields (the ones we
+reach before the enemy does), to keep their foragers out. A site is only taken
+when a wall there makes the enemy walk at least WallGain further to those
+fields, summed (a field it can no longer reach counts as unreachable), without
+cutting us off from them. One wall is planned at a time, the map changes once
+it stands.
+*/
+
+const (
+	wallReplan  = 10 // turns between looking for a new wall site
+	wallSlack   = 4  // how much longer than the shortest enemy route a site's route may be
+	wallSites   = 12 // most sites weighed per plan, each costs two distance fields
+	unreachable = 1000
+)
+
+// narrow tells if the walkable neighbours of c fall apart into two or more
+// groups, so that a wall on c splits them
+func (gm *GameMap) narrow(c Coords) bool {
+	arcs := 0
+	for i, dir := range dirs {
+		prev := dirs[(i+len(dirs)-1)%len(dirs)]
+		if fieldWalkable(gm.Mapped[getCoords(c, dir)]) && !fieldWalkable(gm.Mapped[getCoords(c, prev)]) {
+			arcs++
+		}
+	}
+	return arcs >= 2
+}
+
+// nextToHive tells if c touches any hive, ours or theirs
+func (gm *GameMap) nextToHive(c Coords) bool {
+	for _, dir := range dirs {
+		if t := gm.Mapped[getCoords(c, dir)].Type; t == OWN_HIVE || t == ENEMY_HIVE {
+			return true
+		}
+	}
+	return false
+}
+
+// ourFields are the flower fields with flowers left that we walk to no later than the enemy
+func (gm *GameMap) ourFields(enemy DistanceField) []Coords {
+	var fields []Coords
+	for _, c := range sortedKeys(gm.FlowerFields) {
+		if !gm.FlowerFields[c] || gm.Mapped[c].Flowers == 0 {
+			continue
+		}
+		_, d, ok := gm.NearestHive(c)
+		if theirs, seen := enemy[c]; !ok || seen && theirs.Dist < d {
+			continue
+		}
+		fields = append(fields, c)
+	}
+	return fields
+}
+
+// enemyReach is how far the enemy walks to each of the fields, summed
+func enemyReach(enemy DistanceField, fields []Coords) int {
+	total := 0
+	for _, c := range fields {
+		if cell, ok := enemy[c]; ok {
+			total += min(cell.Dist, unreachable)
+		} else {
+			total += unreachable
+		}
+	}
+	return total
+}
+
+// flowerReach is our walk to the fields we can reach, summed, and how many fields that is
+func flowerReach(field DistanceField, fields []Coords) (int, int) {
+	total, count := 0, 0
+	for _, c := range fields {
+		if cell, ok := field[c]; ok {
+			total += cell.Dist
+			count++
+		}
+	}
+	return total, count
+}
+
+// fieldWithout is the distance field from sources as it would be with our wall on site
+func (gm *GameMap) fieldWithout(sources []Coords, site Coords) DistanceField {
+	return gm.buildFieldAround(sources, true, fieldWalkable, map[Coords]bool{site: true})
+}
+
+// chooseWallSite is the best chokepoint to wall off, if any is worth it
+func (gm *GameMap) chooseWallSite() (Coords, bool) {
+	if len(gm.MyHives) == 0 || len(gm.EnemyHives) == 0 {
+		return Coords{}, false
+	}
+	enemies := sortedKeys(gm.EnemyHives)
+	hives := sortedKeys(gm.MyHives)
+	enemy := gm.buildField(enemies, true, fieldWalkable)
+	fields := gm.ourFields(enemy)
+	if len(fields) == 0 {
+		return Coords{}, false
+	}
+	toFields := gm.buildField(fields, false, fieldWalkable)
+	shortest := unreachable
+	for _, c := range fields {
+		if e, ok := enemy[c]; ok {
+			shortest = min(shortest, e.Dist)
+		}
+	}
+	if shortest == unreachable {
+		return Coords{}, false //already cut off
+	}
+
+	type site struct {
+		at         Coords
+		route, our int
+	}
+	var sites []site
+	for _, c := range sortedKeys(enemy) {
+		tile := gm.Mapped[c]
+		if tile.Type != EMPTY_HEX || tile.IsFlowerField || gm.nextToHive(c) || !gm.narrow(c) {
+			continue
+		}
+		d, ok := toFields[c]
+		if !ok || d.Dist > enemy[c].Dist || enemy[c].Dist+d.Dist > shortest+wallSlack {
+			continue
+		}
+		sites = append(sites, site{c, enemy[c].Dist + d.Dist, d.Dist})
+	}
+	slices.SortStableFunc(sites, func(a, b site) int {
+		if a.route != b.route {
+			return a.route - b.route
+		}
+		return a.our - b.our
+	})
+	if len(sites) > wallSites {
+		sites = sites[:wallSites]
+	}
+
+	before := enemyReach(enemy, fields)
+	ourBefore, fieldsBefore := flowerReach(gm.buildField(hives, true, fieldWalkable), fields)
+	best, bestGain := Coords{}, 0
+	for _, s := range sites {
+		gain := enemyReach(gm.fieldWithout(enemies, s.at), fields) - before
+		ourAfter, fieldsAfter := flowerReach(gm.fieldWithout(hives, s.at), fields)
+		if fieldsAfter < fieldsBefore || ourAfter-ourBefore > fieldsBefore {
+			gm.trace.Of(SUB_WALL).Debug("wall site would cut us off", "site", s.at, "fields", fieldsAfter, "of", fieldsBefore, "detour", ourAfter-ourBefore)
+			continue
+		}
+		gm.trace.Of(SUB_WALL).Debug("wall site", "site", s.at, "gain", gain, "route", s.route)
+		if gain >= gm.params.WallGain && gain > bestGain {
+			best, bestGain = s.at, gain
+		}
+	}
+	if bestGain == 0 {
+		return Coords{}, false
+	}
+	gm.trace.Of(SUB_WALL).Info("wall site chosen", "site", best, "gain", bestGain, "fields", len(fields), "enemyReach", before)
+	return best, true
+}
+
+// planWalls decides if a wall should go up now and where, and tells if a waller is wanted
+func (a *Agent) planWalls(state *GameState, player int) bool {
+	gm := &a.Map
+	if gm.IsWalling {
+		tile := gm.Mapped[gm.WallTarget]
+		if tile.Type == EMPTY_HEX || tile.Type == OWN_BEE || tile.Type == ENEMY_BEE { //bees move on, and a dropped BUILD_WALL is tried again
+			return true
+		}
+		if tile.Type == OWN_WALL {
+			gm.trace.Of(SUB_WALL).Info("wall built", "site", gm.WallTarget)
+		} else {
+			gm.trace.Of(SUB_WALL).Info("wall site taken", "site", gm.WallTarget, "now", tile.Type)
+		}
+		gm.IsWalling = false
+	}
+	if state.Turn < a.nextWallPlan {
+		return false
+	}
+	a.nextWallPlan = state.Turn + wallReplan
+	resources := int(state.PlayerResources[player])
+	keep := a.Params.WallMinResources
+	if gm.IsBuilding {
+		keep += int(arenaRules.HiveCost) //the hive comes first
+	}
+	if len(gm.MyWalls) >= a.Params.MaxWalls || resources < keep+int(arenaRules.WallCost) {
+		gm.trace.Of(SUB_WALL).Debug("no wall now", "walls", len(gm.MyWalls), "resources", resources, "keep", keep)
+		return false
+	}
+	if site, ok := gm.chooseWallSite(); ok {
+		gm.IsWalling = true
+		gm.WallTarget = site
+	}
+	return gm.IsWalling
+}
+
+// goWall walks a waller next to the wall site and builds the wall there
+func (a *Agent) goWall(bee *Bee) Order {
+	gm := &a.Map
+	site := gm.WallTarget
+	bee.Task = site
+	if dir, ok := getDirection(bee.Pos, site); ok && dist(bee.Pos, site) == 1 {
+		if gm.Mapped[site].Type != EMPTY_HEX {
+			gm.note(bee, "waiting for the wall site %v to clear", site)
+			return Order{}
+		}
+		gm.note(bee, "building a wall to the %s", dir) //planWalls lets go of the site once the wall stands
+		return Order{Type: BUILD_WALL, Coords: bee.Pos, Direction: dir}
+	}
+	gm.note(bee, "going to build a wall at %v", site)
+	order, _ := aStar(bee.Pos, site, true, UniformCost, gm)
+	return order
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/patsastus/hive_arena_2025/sim"
+)
+
+import . "hive-arena/common"
+
+// TestWallGetsBuilt plays a simulated game on a map with chokepoints between
+// the players' flower fields and checks that player 0's wall stands on a site
+// its agent chose
+func TestWallGetsBuilt(t *testing.T) {
+	const seed = 105
+	rules := sim.DefaultRules()
+	rules.MaxTurns = 200
+	g := sim.NewGame(sim.Generate(sim.Presets["inverted"], 2, rules, seed), 2, rules, seed)
+	players := make([]sim.Player, 2)
+	for p := range players {
+		players[p] = simPlayer(seed+int64(p), DefaultParams(), NoTrace())
+	}
+	a := NewAgent(seed, DefaultParams())
+	sites := map[Coords]bool{}
+	players[0] = func(state *GameState, player int) []Order {
+		out := &OrderSet{}
+		a.Think(t.Context(), state, player, out)
+		if a.Map.IsWalling {
+			sites[a.Map.WallTarget] = true
+		}
+		return out.Close()
+	}
+	sim.Play(g, players)
+
+	walls := 0
+	for site := range sites {
+		if e := g.Hexes[site].Entity; e != nil && e.Type == WALL && e.Player == 0 {
+			walls++
+		}
+	}
+	if walls == 0 {
+		t.Fatalf("no wall of player 0 on any of the %d sites it chose after 200 turns", len(sites))
+	}
+	t.Logf("%d walls standing on %d sites chosen", walls, len(sites))
+}